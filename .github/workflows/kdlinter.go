@@ -1,86 +1,34 @@
 package main
 
 import (
-	"bufio"
 	"fmt"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strings"
+
+	"github.com/janpreet/kado/packages/kd"
 )
 
 type LintError struct {
 	File    string
 	Line    int
+	Column  int
 	Message string
 }
 
 func (e LintError) Error() string {
-	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Message)
+	return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Column, e.Message)
 }
 
 func LintKDFile(filePath string) ([]LintError, error) {
-	file, err := os.Open(filePath)
+	src, err := os.ReadFile(filePath)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
 
 	var lintErrors []LintError
-	scanner := bufio.NewScanner(file)
-	lineNumber := 0
-	insideBead := false
-	commentRegex := regexp.MustCompile(`^\s*#`)
-	emptyLineCount := 0
-
-	for scanner.Scan() {
-		lineNumber++
-		line := scanner.Text()
-		trimmedLine := strings.TrimSpace(line)
-
-		if strings.HasPrefix(trimmedLine, "bead ") && strings.HasSuffix(trimmedLine, "{") {
-			if insideBead {
-				lintErrors = append(lintErrors, LintError{filePath, lineNumber, "Nested beads are not allowed"})
-			}
-			insideBead = true
-			if !strings.HasPrefix(line, "bead ") {
-				lintErrors = append(lintErrors, LintError{filePath, lineNumber, "Bead declaration should start at the beginning of the line"})
-			}
-		} else if trimmedLine == "}" && insideBead {
-			insideBead = false
-			if !strings.HasPrefix(line, "}") {
-				lintErrors = append(lintErrors, LintError{filePath, lineNumber, "Closing brace should be at the beginning of the line"})
-			}
-		} else if insideBead {
-			if !strings.HasPrefix(line, "  ") {
-				lintErrors = append(lintErrors, LintError{filePath, lineNumber, "Bead content should be indented with two spaces"})
-			}
-		} else {
-			if commentRegex.MatchString(trimmedLine) {
-				if !strings.HasPrefix(trimmedLine, "#") {
-					lintErrors = append(lintErrors, LintError{filePath, lineNumber, "Comments should start at the beginning of the line"})
-				}
-			} else if trimmedLine != "" && strings.HasPrefix(line, " ") {
-				lintErrors = append(lintErrors, LintError{filePath, lineNumber, "Non-bead content should not be indented"})
-			}
-		}
-
-		if trimmedLine == "" {
-			emptyLineCount++
-			if emptyLineCount > 1 {
-				lintErrors = append(lintErrors, LintError{filePath, lineNumber, "Multiple consecutive empty lines are not allowed"})
-			}
-		} else {
-			emptyLineCount = 0
-		}
-	}
-
-	if err := scanner.Err(); err != nil {
-		return nil, err
-	}
-
-	if insideBead {
-		lintErrors = append(lintErrors, LintError{filePath, lineNumber, "Unclosed bead at end of file"})
+	for _, d := range kd.Lint(filePath, src) {
+		lintErrors = append(lintErrors, LintError{filePath, d.Pos.Line, d.Pos.Column, d.Message})
 	}
 
 	return lintErrors, nil
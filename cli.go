@@ -0,0 +1,402 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/janpreet/kado/packages/config"
+	"github.com/janpreet/kado/packages/dag"
+	"github.com/janpreet/kado/packages/display"
+	"github.com/janpreet/kado/packages/engine"
+	"github.com/janpreet/kado/packages/helper"
+	"github.com/janpreet/kado/packages/keybase"
+	"github.com/janpreet/kado/packages/logging"
+	"github.com/janpreet/kado/packages/validate"
+	"github.com/spf13/cobra"
+)
+
+func newRootCommand() *cobra.Command {
+	opts := runOptions{}
+	logFormat := logging.FormatText
+
+	root := &cobra.Command{
+		Use:   "kado",
+		Short: "Drive Ansible, Terraform, Terragrunt and OPA from a single source of truth",
+		Long: `Kado reads bead definitions from the .kd files in the current directory and
+renders the templates listed in the data file (cluster.yaml) for each bead.
+
+Running kado without a command is the same as "kado plan".`,
+		Version:       config.Version,
+		Args:          legacyDataFileArg,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if config.Debug {
+				keybase.Debug = true
+			}
+			return logging.Setup(os.Stderr, logFormat, config.Debug)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 1 {
+				slog.Warn("Passing the data file as an argument is deprecated, use --config", "config", args[0])
+				opts.yamlFilePath = args[0]
+			}
+			return runBeads(opts)
+		},
+	}
+
+	flags := root.PersistentFlags()
+	flags.BoolVar(&config.Debug, "debug", false, "print debug output")
+	flags.StringVar(&logFormat, "log-format", logging.FormatText, "log format: text or json")
+	flags.StringVar(&opts.yamlFilePath, "config", "cluster.yaml", "data file used to render templates")
+	flags.StringVar(&config.LandingZone, "landing-zone", config.LandingZone, "directory that receives cloned repositories and rendered files")
+	flags.StringVar(&config.TemplateDir, "templates", "", "render every .tmpl file in this directory instead of the kado.templates list")
+	flags.BoolVar(&config.Offline, "offline", false, "read bead sources from the vendor directory and never use the network to fetch them")
+	addRunFlags(root, &opts)
+
+	root.AddCommand(
+		newPlanCommand(&opts),
+		newApplyCommand(&opts),
+		newDestroyCommand(&opts),
+		newTestCommand(),
+		newValidateCommand(&opts),
+		newLockCommand(&opts),
+		newVendorCommand(&opts),
+		newSchemaCommand(&opts),
+		newConfigCommand(),
+		newFmtCommand(),
+		newLintCommand(),
+		newKeybaseCommand(),
+		newAICommand(),
+		newVersionCommand(),
+	)
+	return root
+}
+
+// legacyDataFileArg accepts the data file as the only argument of kado
+// itself, as in `kado cluster.yaml`, which earlier versions took instead of
+// --config. Other arguments are unknown commands.
+func legacyDataFileArg(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+	if len(args) == 1 && (strings.HasSuffix(args[0], ".yaml") || strings.HasSuffix(args[0], ".yml")) {
+		return nil
+	}
+	return fmt.Errorf("unknown command %q for %q", args[0], cmd.CommandPath())
+}
+
+func addRunFlags(cmd *cobra.Command, opts *runOptions) {
+	cmd.Flags().IntVar(&opts.parallelism, "parallelism", 4, "maximum number of beads processed at once")
+	cmd.Flags().BoolVar(&opts.failFast, "fail-fast", true, "cancel running beads when one fails; when false only its dependents are skipped")
+	cmd.Flags().StringVar(&opts.reportFormat, "report", "", "also print the run report to stdout: json or junit")
+	cmd.Flags().BoolVar(&opts.clean, "clean", false, "empty the LandingZone first instead of updating the clones of earlier runs")
+}
+
+func newPlanCommand(opts *runOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "plan",
+		Short: "Render templates and show what would change without applying it",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runBeads(*opts)
+		},
+	}
+	addRunFlags(cmd, opts)
+	return cmd
+}
+
+func newApplyCommand(opts *runOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "apply",
+		Aliases: []string{"set"},
+		Short:   "Render templates, plan and apply every bead",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.applyPlan = true
+			return runBeads(*opts)
+		},
+	}
+	addRunFlags(cmd, opts)
+	return cmd
+}
+
+func newDestroyCommand(opts *runOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "destroy [bead...]",
+		Short: "Plan, and with --confirm apply, the destruction of terraform and terragrunt beads",
+		Long: `Destroy saves a destroy plan for every terraform and terragrunt bead, or only
+for the named beads, walking them in reverse dependency order. Plans are pushed
+through any relayed OPA policy and applied only when --confirm is passed.`,
+		ValidArgsFunction: completeBeadNames,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.destroy = true
+			opts.targets = args
+			return runBeads(*opts)
+		},
+	}
+	addRunFlags(cmd, opts)
+	cmd.Flags().BoolVar(&opts.applyPlan, "confirm", false, "apply the destroy plans instead of only showing them")
+	return cmd
+}
+
+func newTestCommand() *cobra.Command {
+	var reportFormat string
+	var clean bool
+	cmd := &cobra.Command{
+		Use:   "test [bead...]",
+		Short: "Run the rego unit tests of OPA beads",
+		Long: `Test clones the repositories the OPA beads read their policies from and runs
+the _test.rego unit tests loaded with every OPA bead's policies, with the
+relay_field overrides of the beads relaying to it applied. Name OPA beads, or
+the beads relaying to them, to test only those.`,
+		ValidArgsFunction: completeBeadNames,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runPolicyTests(args, reportFormat, clean)
+		},
+	}
+	cmd.Flags().StringVar(&reportFormat, "report", "", "also print the test report to stdout: json or junit")
+	cmd.Flags().BoolVar(&clean, "clean", false, "empty the LandingZone first instead of updating the clones of earlier runs")
+	return cmd
+}
+
+func newValidateCommand(opts *runOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "validate",
+		Short: "Check the beads, the data file and the templates without running anything",
+		Long: `Validate checks that the beads named in depends_on and relay exist, that every
+enabled bead has the fields its type needs, that the data file parses and lists
+its templates as expected, and that every template starts with a <file name>
+header and parses. Every problem is printed with its file and line. The same
+checks run before plan, apply and destroy.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			beads, beadMap, err := loadBeads()
+			if err != nil {
+				return err
+			}
+			return checkConfig(beads, beadMap, opts.yamlFilePath)
+		},
+	}
+}
+
+func newLockCommand(opts *runOptions) *cobra.Command {
+	var update bool
+	cmd := &cobra.Command{
+		Use:   "lock",
+		Short: "Pin the git source of every bead to a commit in kado.lock",
+		Long: `Lock resolves the source and refs of every bead a run processes, including
+sources set by relay_field, to a commit and writes them to kado.lock. Runs
+check out the pinned commits instead of the current head of each ref and add
+sources the lock file does not pin yet. Sources already pinned keep their
+commit unless --update is given.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return lockSources(opts.yamlFilePath, update)
+		},
+	}
+	cmd.Flags().BoolVar(&update, "update", false, "resolve every source again instead of keeping pinned commits")
+	return cmd
+}
+
+func newVendorCommand(opts *runOptions) *cobra.Command {
+	var archive string
+	cmd := &cobra.Command{
+		Use:   "vendor",
+		Short: "Store every bead source in vendor/ for offline runs",
+		Long: `Vendor stores the source of every bead a run processes, including sources set
+by relay_field, in the vendor directory: git repositories as mirror clones
+with all branches and tags, remote tarballs as downloaded. Runs with
+--offline then read sources from there and never use the network to fetch
+them. Local directories and tarballs are used where they are. With
+--archive the vendor directory is also packed into a tarball to copy to
+hosts without network access; extract it next to the .kd files.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return vendorSources(opts.yamlFilePath, archive)
+		},
+	}
+	cmd.Flags().StringVar(&archive, "archive", "", "also pack the vendor directory into this .tar.gz file")
+	return cmd
+}
+
+func newSchemaCommand(opts *runOptions) *cobra.Command {
+	var data bool
+	cmd := &cobra.Command{
+		Use:   "schema [type...]",
+		Short: "Print the JSON Schema of bead fields or of the data file",
+		Long: `Schema prints, as JSON Schema, the fields beads of every registered type, or
+of the named types, accept. With --data it prints the JSON Schema set as
+kado.schema in the data file, with the kado section added, for editors to
+check the data file with.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var schema map[string]interface{}
+			if data {
+				var err error
+				schema, err = validate.DataSchema(opts.yamlFilePath)
+				if err != nil {
+					return err
+				}
+				if schema == nil {
+					return fmt.Errorf("%s sets no kado.schema", opts.yamlFilePath)
+				}
+			} else {
+				var err error
+				schema, err = beadSchema(args)
+				if err != nil {
+					return err
+				}
+			}
+			out, err := json.MarshalIndent(schema, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to encode schema: %v", err)
+			}
+			fmt.Println(string(out))
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&data, "data", false, "print the schema of the data file instead of the bead fields")
+	return cmd
+}
+
+func newConfigCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "config",
+		Short: "Show the bead configuration and order of execution",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			beads, _, err := loadBeads()
+			if err != nil {
+				return err
+			}
+			graph, err := dag.FromBeads(beads)
+			if err != nil {
+				return fmt.Errorf("failed to build execution graph: %v", err)
+			}
+			display.DisplayBeadConfig(beads, graph)
+			return nil
+		},
+	}
+}
+
+func newFmtCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "fmt [dir]",
+		Short: "Rewrite .kd files in canonical style",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := "."
+			if len(args) > 0 {
+				dir = args[0]
+			}
+			if err := engine.FormatKDFilesInDir(dir); err != nil {
+				return fmt.Errorf("failed to format .kd files: %v", err)
+			}
+			return nil
+		},
+	}
+}
+
+func newLintCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "lint [dir]",
+		Short: "Report syntax errors and style problems in .kd files",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := "."
+			if len(args) > 0 {
+				dir = args[0]
+			}
+			diags, err := engine.LintKDFilesInDir(dir)
+			if err != nil {
+				return err
+			}
+			for _, d := range diags {
+				fmt.Println(d)
+			}
+			if len(diags) > 0 {
+				return fmt.Errorf("found %d problem(s) in .kd files", len(diags))
+			}
+			return nil
+		},
+	}
+}
+
+func newKeybaseCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "keybase",
+		Short: "Manage the Keybase account and notes used in templates",
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:   "link",
+		Short: "Link the Keybase account",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			helper.HandleKeybaseCommand([]string{"link"})
+		},
+	})
+
+	note := &cobra.Command{
+		Use:   "note",
+		Short: "Create, list, view and share Keybase notes",
+	}
+	noteCommand := func(use, short string, args cobra.PositionalArgs) *cobra.Command {
+		return &cobra.Command{
+			Use:   use,
+			Short: short,
+			Args:  args,
+			Run: func(cmd *cobra.Command, args []string) {
+				helper.HandleNoteCommand(append([]string{cmd.Name()}, args...))
+			},
+		}
+	}
+	note.AddCommand(
+		noteCommand("create <note_name>", "Create a note from standard input", cobra.ExactArgs(1)),
+		noteCommand("create-with-tags <note_name> <tag1,tag2,...>", "Create a tagged note from standard input", cobra.ExactArgs(2)),
+		noteCommand("list", "List stored notes", cobra.NoArgs),
+		noteCommand("view <note_name>", "Print a note", cobra.ExactArgs(1)),
+		noteCommand("share <note_name> <keybase_username>", "Share a note with another Keybase user", cobra.ExactArgs(2)),
+		noteCommand("search-by-tag <tag>", "List notes with a tag", cobra.ExactArgs(1)),
+	)
+	cmd.AddCommand(note)
+	return cmd
+}
+
+func newAICommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "ai",
+		Short: "Get AI recommendations for the configuration, if enabled",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			engine.RunAI()
+		},
+	}
+}
+
+func newVersionCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "version",
+		Short: "Print the kado version",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			fmt.Println("Version:", config.Version)
+		},
+	}
+}
+
+// completeBeadNames completes bead names from the .kd files in the current
+// directory.
+func completeBeadNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	beads, _, err := loadBeads()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var names []string
+	for _, b := range beads {
+		names = append(names, b.Name)
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/janpreet/kado/packages/bead"
+	"github.com/janpreet/kado/packages/helper"
+	"github.com/janpreet/kado/packages/lockfile"
+)
+
+// pinnedRefs returns the commit kado.lock pins source and refs to, or refs
+// itself if the lock file has no entry for them.
+func pinnedRefs(sources *lockfile.File, source, refs string) string {
+	if sources == nil {
+		return refs
+	}
+	if entry, ok := sources.Lookup(source, refs); ok && entry.Commit != "" {
+		return entry.Commit
+	}
+	return refs
+}
+
+// lockSources resolves the git source of every bead a run processes,
+// including sources set by relay_field, to a commit and writes them to
+// kado.lock. Sources already in the lock file keep their commit unless
+// update is set; entries no bead uses any more are dropped.
+func lockSources(yamlFilePath string, update bool) error {
+	allBeads, beadMap, err := loadBeads()
+	if err != nil {
+		return err
+	}
+	if err := checkConfig(allBeads, beadMap, yamlFilePath); err != nil {
+		return err
+	}
+	existing, err := lockfile.Read(lockfile.FileName)
+	if err != nil {
+		return err
+	}
+
+	locked := &lockfile.File{}
+	for _, b := range runnableBeads(allBeads, beadMap) {
+		source, refs := b.Fields["source"], b.Fields["refs"]
+		if source == "" {
+			continue
+		}
+		entry, ok := locked.Lookup(source, refs)
+		if !ok && !update {
+			entry, ok = existing.Lookup(source, refs)
+		}
+		if !ok {
+			ctx := &bead.Context{
+				Context: context.Background(),
+				Logger:  slog.Default().With("bead", b.Name, "type", b.Type),
+			}
+			commit, err := helper.ResolveCommit(ctx, source, refs)
+			if err != nil {
+				return fmt.Errorf("failed to resolve source of bead %s: %v", b.Name, err)
+			}
+			if commit == "" {
+				continue
+			}
+			entry.Commit = commit
+			if previous, ok := existing.Lookup(source, refs); !ok || previous.Commit != commit {
+				slog.Info("Source locked", "bead", b.Name, "source", source, "ref", refs, "commit", commit)
+			}
+		}
+		locked.Record(b.Name, source, refs, entry.Commit)
+	}
+
+	if err := locked.Write(lockfile.FileName); err != nil {
+		return err
+	}
+	slog.Info("Lock file written", "file", lockfile.FileName, "sources", len(locked.Sources))
+	return nil
+}
@@ -1,18 +1,28 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/janpreet/kado/packages/bead"
 	"github.com/janpreet/kado/packages/config"
+	"github.com/janpreet/kado/packages/dag"
 	"github.com/janpreet/kado/packages/display"
-	"github.com/janpreet/kado/packages/engine"
 	"github.com/janpreet/kado/packages/helper"
+	"github.com/janpreet/kado/packages/lockfile"
 	"github.com/janpreet/kado/packages/render"
+	"github.com/janpreet/kado/packages/report"
+
+	_ "github.com/janpreet/kado/packages/ansible"
+	_ "github.com/janpreet/kado/packages/opa"
+	_ "github.com/janpreet/kado/packages/terraform"
+	_ "github.com/janpreet/kado/packages/terragrunt"
 )
 
 func convertYAMLToSlice(yamlData map[string]interface{}) []map[string]interface{} {
@@ -20,288 +30,557 @@ func convertYAMLToSlice(yamlData map[string]interface{}) []map[string]interface{
 	return result
 }
 
-func applyRelayOverrides(b *bead.Bead) map[string]string {
-	overrides := make(map[string]string)
+// applyRelayOverrides returns the relay_field overrides b applies to the
+// relay target named target. relay_field is either a string of key=value
+// pairs or a block. A key prefixed with a target name, as in
+// "policy.path=...", and a nested block named after a target only apply to
+// that target; other keys apply to every target.
+func applyRelayOverrides(b *bead.Bead, target string) map[string]interface{} {
+	overrides := make(map[string]interface{})
+	if block, ok := b.Values["relay_field"].(map[string]interface{}); ok {
+		scoped, _ := block[target].(map[string]interface{})
+		for key, value := range block {
+			if _, nested := value.(map[string]interface{}); !nested {
+				overrides[key] = value
+			}
+		}
+		for key, value := range scoped {
+			overrides[key] = value
+		}
+		return overrides
+	}
+
 	if relayField, ok := b.Fields["relay_field"]; ok {
+		scoped := make(map[string]interface{})
 		pairs := strings.Split(relayField, ",")
 		for _, pair := range pairs {
 			keyValue := strings.SplitN(pair, "=", 2)
-			if len(keyValue) == 2 {
-				overrides[strings.TrimSpace(keyValue[0])] = strings.TrimSpace(keyValue[1])
+			if len(keyValue) != 2 {
+				continue
 			}
+			key, value := strings.TrimSpace(keyValue[0]), strings.TrimSpace(keyValue[1])
+			if name, field, ok := strings.Cut(key, "."); ok {
+				if name == target {
+					scoped[field] = value
+				}
+				continue
+			}
+			overrides[key] = value
+		}
+		for key, value := range scoped {
+			overrides[key] = value
 		}
 	}
 	return overrides
 }
 
-func processBead(b bead.Bead, yamlData map[string]interface{}, beadMap map[string]bead.Bead, processed map[string]int, processedBeads *[]string, applyPlan bool, originBead string, relayToOPA bool) error {
-	config.DebugPrint("DEBUG: processBead called for %s (Enabled: %v, Origin: %s)\n", b.Name, *b.Enabled, originBead)
-    
-    if b.Enabled != nil && !*b.Enabled {
-		config.DebugPrint("DEBUG: Skipping disabled bead: %s\n", b.Name)       
-		return nil
-    }
-
-    if count, ok := processed[b.Name]; ok && count > 0 && originBead == "" {
-		config.DebugPrint("DEBUG: Skipping already processed bead: %s\n", b.Name)
-        return nil
-    }
-
-	config.DebugPrint("DEBUG: Actually processing bead: %s\n", b.Name)
-
-    if originBead != "" {
-        repoPath := filepath.Join(config.LandingZone, b.Name)
-        if helper.FileExists(repoPath) {
-            fmt.Printf("Removing existing repository at: %s\n", repoPath)
-            err := os.RemoveAll(repoPath)
-            if err != nil {
-                return fmt.Errorf("failed to remove existing repository for bead %s: %v", b.Name, err)
-            }
-        }
-    }
-
-    if source, ok := b.Fields["source"]; ok && source != "" {
-        refs := ""
-        if refsVal, ok := b.Fields["refs"]; ok {
-            refs = refsVal
-        }
-        err := helper.CloneRepo(source, config.LandingZone, b.Name, refs)
-        if err != nil {
-            return fmt.Errorf("failed to clone repo for bead %s: %v", b.Name, err)
-        }
-    }
-
-    display.DisplayBead(b)
-
-    switch b.Name {
-    case "ansible":
-        err := helper.ProcessAnsibleBead(b, yamlData, relayToOPA, applyPlan)
-        if err != nil {
-            return err
-        }
-    case "terraform":
-        err := helper.ProcessTerraformBead(b, yamlData, applyPlan)
-        if err != nil {
-            return err
-        }
-    case "opa":
-        err := helper.ProcessOPABead(b, applyPlan, originBead)
-        if err != nil {
-            return err
-        }
-    case "terragrunt":
-        err := helper.ProcessTerragruntBead(b, yamlData, applyPlan)
-        if err != nil {
-            return err
-        }
-    default:
-        return fmt.Errorf("unknown bead type: %s", b.Name)
-    }
-
-    processed[b.Name]++
-    *processedBeads = append(*processedBeads, b.Name)
-    config.DebugPrint("DEBUG: Added %s to processedBeads\n", b.Name)
-
-    if relay, ok := b.Fields["relay"]; ok {
-		config.DebugPrint("DEBUG: Relay found for %s to %s\n", b.Name, relay)
-        if relayBead, ok := beadMap[relay]; ok {
-            if relayBead.Enabled != nil && !*relayBead.Enabled {
-                config.DebugPrint("DEBUG: Skipping disabled relay bead: %s\n", relayBead.Name)
-                return nil
-            }
-            overrides := applyRelayOverrides(&b)
-            for key, value := range overrides {
-                relayBead.Fields[key] = value
-            }
-            config.DebugPrint("DEBUG: Calling processBead for relay %s\n", relayBead.Name)
-            return processBead(relayBead, yamlData, beadMap, processed, processedBeads, applyPlan, b.Name, b.Name == "opa")
-        } else {
-            config.DebugPrint("DEBUG: Relay bead %s not found in beadMap\n", relay)
-        }
-    }
-
-    return nil
+// relayedBead returns target as b relays to it, with the relay_field
+// overrides of b for target applied to its fields.
+func relayedBead(b, target bead.Bead) bead.Bead {
+	overrides := applyRelayOverrides(&b, target.Name)
+	fields := make(map[string]string, len(target.Fields)+len(overrides))
+	for key, value := range target.Fields {
+		fields[key] = value
+	}
+	values := make(map[string]interface{}, len(target.Values)+len(overrides))
+	for key, value := range target.Values {
+		values[key] = value
+	}
+	for key, value := range overrides {
+		values[key] = value
+		fields[key] = config.FieldString(value)
+	}
+	target.Fields = fields
+	target.Values = values
+	return target
 }
 
-func convertTemplatePaths(paths []interface{}) []string {
-	var result []string
-	for _, path := range paths {
-		if strPath, ok := path.(string); ok {
-			result = append(result, strPath)
+// run holds the state shared by beads processed concurrently.
+type run struct {
+	yamlData  map[string]interface{}
+	beadMap   map[string]bead.Bead
+	applyPlan bool
+	destroy   bool
+
+	mu             sync.Mutex
+	processed      map[string]int
+	processedBeads []string
+	outputs        map[string]map[string]interface{}
+	beadLocks      map[string]*sync.Mutex
+
+	report *report.Report
+	// sources holds the commits kado.lock pins the git sources of the
+	// beads to; sources it does not pin yet are added.
+	sources *lockfile.File
+}
+
+func newRun(yamlData map[string]interface{}, beadMap map[string]bead.Bead, applyPlan bool, rep *report.Report) *run {
+	return &run{
+		report:    rep,
+		yamlData:  yamlData,
+		beadMap:   beadMap,
+		applyPlan: applyPlan,
+		processed: make(map[string]int),
+		outputs:   make(map[string]map[string]interface{}),
+		beadLocks: make(map[string]*sync.Mutex),
+	}
+}
+
+// beadLock serializes work on a single bead, which may be reached both from
+// the graph and through a relay.
+func (r *run) beadLock(name string) *sync.Mutex {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	l, ok := r.beadLocks[name]
+	if !ok {
+		l = &sync.Mutex{}
+		r.beadLocks[name] = l
+	}
+	return l
+}
+
+// relayTargets returns the enabled beads b relays to, in the order of its
+// relay list, with the overrides of b applied.
+func (r *run) relayTargets(b bead.Bead) []bead.Bead {
+	var targets []bead.Bead
+	for _, name := range b.List("relay") {
+		target, ok := r.beadMap[name]
+		if !ok {
+			slog.Warn("Relay bead not found", "bead", b.Name, "relay", name)
+			continue
 		}
+		if target.Enabled != nil && !*target.Enabled {
+			slog.Debug("Skipping disabled relay bead", "bead", target.Name, "origin", b.Name)
+			continue
+		}
+		targets = append(targets, relayedBead(b, target))
 	}
-	return result
+	return targets
 }
 
-func main() {
-	var yamlFilePath string
+// gates returns the OPA beads b relays to. They run as gates between the
+// plan and apply phases of b, so the plan they evaluate is the one that gets
+// applied.
+func (r *run) gates(b bead.Bead) []bead.Bead {
+	var gates []bead.Bead
+	for _, target := range r.relayTargets(b) {
+		if target.Type == "opa" {
+			gates = append(gates, target)
+		}
+	}
+	return gates
+}
 
-	if len(os.Args) > 1 {
-		switch os.Args[1] {
-		case "version":
-			fmt.Println("Version:", config.Version)
-			return
+func (r *run) beadOutputs(name string) map[string]interface{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.outputs[name]
+}
 
-		case "config":
-			handleConfigCommand()
-			return
+func (r *run) snapshotOutputs() map[string]map[string]interface{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	outputs := make(map[string]map[string]interface{}, len(r.outputs))
+	for name, values := range r.outputs {
+		outputs[name] = values
+	}
+	return outputs
+}
 
-		case "fmt":
-			handleFormatCommand()
-			return
+// errAlreadyProcessed is returned by runBead for a bead the graph reaches
+// after it was processed as a relay target.
+var errAlreadyProcessed = errors.New("bead already processed")
+
+// processBead runs b and then the beads it relays to. relayChain lists the
+// beads that relayed to b, the last one being its origin, and inputs holds
+// the outputs its origin passed on. A destroy run does not follow relays:
+// the beads they lead to, such as an Ansible playbook, would run against
+// what was just destroyed, and the graph reaches every Destroyer itself.
+func (r *run) processBead(ctx context.Context, b bead.Bead, relayChain []string, inputs map[string]interface{}) error {
+	if b.Enabled != nil && !*b.Enabled {
+		slog.Debug("Skipping disabled bead", "bead", b.Name)
+		return nil
+	}
 
-		case "ai":
-			engine.RunAI()
-			return
+	if err := r.runBead(ctx, b, relayChain, inputs); err != nil {
+		if err == errAlreadyProcessed {
+			// Its relays were followed when it was processed.
+			return nil
+		}
+		return err
+	}
+	if r.destroy {
+		return nil
+	}
+	return r.processRelays(ctx, b, relayChain, r.beadOutputs(b.Name))
+}
 
-		case "keybase":
-			if len(os.Args) < 3 {
-				fmt.Println("Usage: kado keybase [debug] <command>")
-				return
+// processRelays processes the beads b relays to, one after the other, and
+// passes them outputs. An OPA bead already ran as the gate of b, so only the
+// beads it relays to in turn are processed; they receive the outputs of b.
+func (r *run) processRelays(ctx context.Context, b bead.Bead, relayChain []string, outputs map[string]interface{}) error {
+	chain := append(append([]string(nil), relayChain...), b.Name)
+	for _, target := range r.relayTargets(b) {
+		if target.Type == "opa" {
+			if err := r.processRelays(ctx, target, chain, outputs); err != nil {
+				return err
 			}
-			helper.HandleKeybaseCommand(os.Args[2:])
-			return
+			continue
+		}
+		slog.Debug("Relaying bead", "bead", b.Name, "relay", target.Name)
+		if err := r.processBead(ctx, target, chain, outputs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-		default:
-			if strings.HasSuffix(os.Args[1], ".yaml") {
-				yamlFilePath = os.Args[1]
-			} else {
-				yamlFilePath = "cluster.yaml"
-			}
+// runBead runs a single bead's handler, with its output prefixed by the bead
+// name so that concurrent beads can be told apart.
+func (r *run) runBead(ctx context.Context, b bead.Bead, relayChain []string, inputs map[string]interface{}) (err error) {
+	var originBead string
+	if len(relayChain) > 0 {
+		originBead = relayChain[len(relayChain)-1]
+	}
+
+	lock := r.beadLock(b.Name)
+	lock.Lock()
+	defer lock.Unlock()
+
+	r.mu.Lock()
+	count := r.processed[b.Name]
+	r.mu.Unlock()
+	if count > 0 && originBead == "" {
+		slog.Debug("Skipping already processed bead", "bead", b.Name)
+		return errAlreadyProcessed
+	}
+
+	stdout := display.NewPrefixWriter(os.Stdout, "["+b.Name+"] ")
+	stderr := display.NewPrefixWriter(os.Stderr, "["+b.Name+"] ")
+	defer stdout.Flush()
+	defer stderr.Flush()
+
+	beadCtx := &bead.Context{
+		Context:     ctx,
+		Data:        r.yamlData,
+		LandingZone: config.LandingZone,
+		Apply:       r.applyPlan,
+		Destroy:     r.destroy,
+		Origin:      originBead,
+		OriginType:  r.beadMap[originBead].Type,
+		Outputs:     r.snapshotOutputs(),
+		Inputs:      inputs,
+		Stdout:      stdout,
+		Stderr:      stderr,
+		Logger:      slog.Default().With("bead", b.Name, "type", b.Type),
+		Result:      r.report.Start(b.Name, b.Type, relayChain),
+	}
+	defer func() {
+		if err != nil && ctx.Err() != nil {
+			r.report.Cancel(beadCtx.Result)
+			return
 		}
-	} else {
-		yamlFilePath = "cluster.yaml"
+		r.report.Finish(beadCtx.Result, err)
+	}()
+	beadCtx.Log().Info("Processing bead", "origin", originBead)
+	beadCtx.Log().Debug("Bead fields", "fields", b.LogFields())
+	if inputs != nil {
+		beadCtx.Log().Debug("Relay inputs", "inputs", inputs)
 	}
 
-	fmt.Println("Starting processing-")
+	beadCtx.SetPhase("clone")
 
-	applyPlan := len(os.Args) > 1 && os.Args[1] == "set"
+	if source, ok := b.Fields["source"]; ok && source != "" {
+		refs := ""
+		if refsVal, ok := b.Fields["refs"]; ok {
+			refs = refsVal
+		}
+		checkout := pinnedRefs(r.sources, source, refs)
+		if checkout != refs {
+			beadCtx.Log().Info("Using commit pinned in lock file", "commit", checkout, "ref", refs)
+		}
+		commit, err := helper.CloneRepo(beadCtx, source, config.LandingZone, b.Name, checkout)
+		if err != nil {
+			if checkout != refs {
+				return fmt.Errorf("failed to clone repo for bead %s at commit %s pinned in %s, run `kado lock --update` to pin a new one: %v", b.Name, checkout, lockfile.FileName, err)
+			}
+			return fmt.Errorf("failed to clone repo for bead %s: %v", b.Name, err)
+		}
+		if commit != "" && r.sources != nil {
+			r.sources.Record(b.Name, source, refs, commit)
+		}
+	}
 
-	kdFiles, err := render.GetKDFiles(".")
+	handler, err := bead.Lookup(b.Type)
 	if err != nil {
-		log.Fatalf("Failed to get KD files: %v", err)
+		return err
+	}
+	beadCtx.SetPhase("validate")
+	if err := bead.Validate(handler, b); err != nil {
+		return err
 	}
 
-	beadMap := make(map[string]bead.Bead)
-	var primaryKdFile string
-	
-	for i, kdFile := range kdFiles {
-		config.DebugPrint("DEBUG: Loading file: %s\n", kdFile)
-		bs, err := config.LoadBeadsConfig(kdFile)
+	beadCtx.SetPhase("plan")
+	if err := handler.Plan(beadCtx, b); err != nil {
+		return err
+	}
+	if gates := r.gates(b); len(gates) > 0 {
+		beadCtx.SetPhase("gate")
+		planOutputs, err := handler.Outputs(beadCtx, b)
 		if err != nil {
-			log.Fatalf("Failed to load beads config from %s: %v", kdFile, err)
+			return fmt.Errorf("failed to collect outputs of bead %s: %v", b.Name, err)
 		}
-		
-		if i == 0 {
-			primaryKdFile = kdFile
-		}
-		
-		for _, b := range bs {
-			if _, ok := beadMap[b.Name]; ok {
-				if kdFile != primaryKdFile {
-					fmt.Printf("WARNING: Ignoring conflicting configuration for bead %s in file %s. Using configuration from %s\n", b.Name, kdFile, primaryKdFile)
-				} else {
-					beadMap[b.Name] = b
-					config.DebugPrint("DEBUG: Updated bead %s (Enabled: %v) from primary file %s\n", b.Name, *b.Enabled, kdFile)
-				}
-			} else {
-				beadMap[b.Name] = b
-				config.DebugPrint("DEBUG: Loaded new bead %s (Enabled: %v) from file %s\n", b.Name, *b.Enabled, kdFile)
+		chain := append(append([]string(nil), relayChain...), b.Name)
+		for _, gate := range gates {
+			beadCtx.Log().Info("Evaluating the saved plan against the policy", "gate", gate.Name)
+			if err := r.runBead(ctx, gate, chain, planOutputs); err != nil {
+				return fmt.Errorf("gate %s: %v", gate.Name, err)
 			}
 		}
 	}
-	
-	var allBeads []bead.Bead
-	for _, b := range beadMap {
-		allBeads = append(allBeads, b)
+	if r.applyPlan {
+		beadCtx.SetPhase("apply")
+		if err := handler.Apply(beadCtx, b); err != nil {
+			return err
+		}
 	}
-	
-	validBeads, invalidBeadReasons := config.GetValidBeadsWithDefaultEnabled(allBeads)
-	
-	config.DebugPrint("DEBUG: Final bead configurations:")
-	for _, b := range validBeads {
-		fmt.Printf("  - %s (Enabled: %v)\n", b.Name, *b.Enabled)
+	beadCtx.SetPhase("outputs")
+	beadOutputs, err := handler.Outputs(beadCtx, b)
+	if err != nil {
+		return fmt.Errorf("failed to collect outputs of bead %s: %v", b.Name, err)
+	}
+
+	r.mu.Lock()
+	r.outputs[b.Name] = beadOutputs
+	r.processed[b.Name]++
+	r.processedBeads = append(r.processedBeads, b.Name)
+	r.mu.Unlock()
+	beadCtx.Log().Debug("Bead processed")
+
+	return nil
+}
+
+func convertTemplatePaths(paths []interface{}) []string {
+	var result []string
+	for _, path := range paths {
+		if strPath, ok := path.(string); ok {
+			result = append(result, strPath)
+		}
 	}
+	return result
+}
 
-	yamlData, err := config.LoadYAMLConfig(yamlFilePath)
+func main() {
+	if err := newRootCommand().Execute(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+// runOptions selects what a run of the bead graph does.
+type runOptions struct {
+	yamlFilePath string
+	applyPlan    bool
+	destroy      bool
+	// targets limits the run to the named beads; empty means all beads.
+	targets     []string
+	parallelism int
+	failFast    bool
+	// reportFormat, if set, also prints the run report to stdout.
+	reportFormat string
+	// clean empties the LandingZone before the run instead of reusing the
+	// clones of earlier runs.
+	clean bool
+}
+
+func runBeads(opts runOptions) error {
+	mode := "plan"
+	switch {
+	case opts.destroy:
+		mode = "destroy"
+	case opts.applyPlan:
+		mode = "apply"
+	}
+	switch opts.reportFormat {
+	case "", report.FormatJSON, report.FormatJUnit:
+	default:
+		return fmt.Errorf("unknown report format %q, expected %s or %s", opts.reportFormat, report.FormatJSON, report.FormatJUnit)
+	}
+	slog.Info("Starting run", "mode", mode, "config", opts.yamlFilePath, "landing_zone", config.LandingZone)
+
+	allBeads, beadMap, err := loadBeads()
 	if err != nil {
-		log.Fatalf("Failed to load YAML config: %v", err)
+		return err
+	}
+	if err := checkConfig(allBeads, beadMap, opts.yamlFilePath); err != nil {
+		return err
 	}
 
-	err = helper.SetupLandingZone()
+	graph, err := dag.FromBeads(allBeads)
 	if err != nil {
-		log.Fatalf("Failed to setup LandingZone: %v", err)
+		return fmt.Errorf("failed to build execution graph: %v", err)
+	}
+	if opts.destroy {
+		graph = graph.Reverse()
 	}
 
-	var invalidBeadNames []string
-	var processedBeads []string
+	targets := make(map[string]bool, len(opts.targets))
+	for _, name := range opts.targets {
+		if _, ok := beadMap[name]; !ok {
+			return fmt.Errorf("unknown bead %q", name)
+		}
+		targets[name] = true
+	}
 
-	config.DebugPrint("DEBUG: Final bead configurations:")
-	for _, b := range validBeads {
-		fmt.Printf("  - %s (Enabled: %v)\n", b.Name, *b.Enabled)
+	validBeads, invalidBeadReasons := config.GetValidBeadsWithDefaultEnabled(allBeads)
+
+	yamlData, err := config.LoadYAMLConfig(opts.yamlFilePath)
+	if err != nil {
+		return fmt.Errorf("failed to load YAML config: %v", err)
 	}
 
-	config.DebugPrint("DEBUG: Valid beads:")
-	for _, b := range validBeads {
-		fmt.Printf("  - %s (Enabled: %v)\n", b.Name, *b.Enabled)
+	lock, err := helper.SetupLandingZone(opts.clean)
+	if err != nil {
+		return fmt.Errorf("failed to setup LandingZone: %v", err)
 	}
-	
-	processed := make(map[string]int)
-	
+	defer lock.Release()
+
+	validByName := make(map[string]bead.Bead, len(validBeads))
 	for _, b := range validBeads {
-		config.DebugPrint("DEBUG: Main loop processing bead %s (Enabled: %v)\n", b.Name, *b.Enabled)
-		if b.Enabled != nil && !*b.Enabled {
-			config.DebugPrint("DEBUG: Skipping disabled bead in main loop: %s\n", b.Name)
-			continue
-		}
-		if err := processBead(b, yamlData, beadMap, processed, &processedBeads, applyPlan, "", false); err != nil {
-			log.Fatalf("Failed to process bead %s: %v", b.Name, err)
+		validByName[b.Name] = b
+	}
+	rep := report.New(mode)
+	for _, name := range graph.Nodes() {
+		if reason, ok := invalidBeadReasons[name]; ok {
+			slog.Info("Skipping bead", "bead", name, "reason", reason)
+			rep.Skip(name, beadMap[name].Type, "disabled")
 		}
 	}
 
-	for beadIndex, reason := range invalidBeadReasons {
-		beadName := fmt.Sprintf("bead_%s", beadIndex)
-		fmt.Printf("Skipping bead: %s, Reason: %s\n", beadName, reason)
-		invalidBeadNames = append(invalidBeadNames, fmt.Sprintf("%s: %s", beadName, reason))
-	}	
+	sources, err := lockfile.Read(lockfile.FileName)
+	if err != nil {
+		return err
+	}
 
-	fmt.Println("\nDEBUG: Processed beads:")
-	for _, name := range processedBeads {
-		fmt.Printf("  - %s\n", name)
+	r := newRun(yamlData, beadMap, opts.applyPlan, rep)
+	r.destroy = opts.destroy
+	r.sources = sources
+	runOpts := dag.RunOptions{
+		Parallelism: opts.parallelism,
+		FailFast:    opts.failFast,
+		Skipped: func(name string, reason error) {
+			slog.Warn("Skipping bead", "bead", name, "reason", reason)
+			rep.Skip(name, beadMap[name].Type, reason.Error())
+		},
 	}
-	
-	fmt.Println("\nDEBUG: Skipped beads:")
-	for name, reason := range invalidBeadReasons {
-		fmt.Printf("  - %s: %s\n", name, reason)
+	err = graph.Run(context.Background(), runOpts, func(ctx context.Context, name string) error {
+		b, ok := validByName[name]
+		if !ok {
+			return nil
+		}
+		if len(targets) > 0 && !targets[name] {
+			return nil
+		}
+		if opts.destroy {
+			handler, err := bead.Lookup(b.Type)
+			if err != nil {
+				return err
+			}
+			if !bead.CanDestroy(handler) {
+				slog.Debug("Bead has nothing to destroy", "bead", b.Name, "type", b.Type)
+				rep.Skip(b.Name, b.Type, "nothing to destroy")
+				return nil
+			}
+		}
+		if err := r.processBead(ctx, b, nil, nil); err != nil {
+			slog.Error("Bead failed", "bead", name, "error", err)
+			return err
+		}
+		return nil
+	})
+	if reportErr := writeReport(rep, opts.reportFormat); reportErr != nil {
+		slog.Error("Failed to write run report", "error", reportErr)
 	}
+	if sources.Changed() {
+		if lockErr := sources.Write(lockfile.FileName); lockErr != nil {
+			slog.Error("Failed to write lock file", "error", lockErr)
+		} else {
+			slog.Info("Source commits recorded", "lock_file", lockfile.FileName)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to process beads:\n%v", err)
+	}
+
+	if opts.destroy && !opts.applyPlan {
+		slog.Info("Destroy plans saved. Run `kado destroy --confirm` to apply them.")
+	}
+
+	slog.Info("Run finished", "mode", mode, "processed", r.processedBeads)
+	return nil
+}
 
+// writeReport saves the run report to the LandingZone and, if format is
+// set, also prints it to stdout.
+func writeReport(rep *report.Report, format string) error {
+	rep.Close()
+	if err := rep.Save(config.LandingZone); err != nil {
+		return err
+	}
+	slog.Info("Run report written", "json", filepath.Join(config.LandingZone, report.JSONFile), "junit", filepath.Join(config.LandingZone, report.JUnitFile))
+	if format == "" {
+		return nil
+	}
+	return rep.Write(os.Stdout, format)
 }
 
-func handleConfigCommand() {
+// loadBeads reads every .kd file under the current directory. The returned
+// slice keeps the order beads were first declared in; when a bead name is
+// declared in several files the first file wins.
+func loadBeads() ([]bead.Bead, map[string]bead.Bead, error) {
 	kdFiles, err := render.GetKDFiles(".")
 	if err != nil {
-		log.Fatalf("Failed to get KD files: %v", err)
+		return nil, nil, fmt.Errorf("failed to get KD files: %v", err)
 	}
 
-	var beads []bead.Bead
-	for _, kdFile := range kdFiles {
+	beadMap := make(map[string]bead.Bead)
+	var names []string
+	var primaryKdFile string
+
+	for i, kdFile := range kdFiles {
+		slog.Debug("Loading beads", "file", kdFile)
 		bs, err := config.LoadBeadsConfig(kdFile)
 		if err != nil {
-			log.Fatalf("Failed to load beads config from %s: %v", kdFile, err)
+			return nil, nil, fmt.Errorf("failed to load beads config from %s: %v", kdFile, err)
 		}
-		beads = append(beads, bs...)
-	}
 
-	display.DisplayBeadConfig(beads)
-}
+		if i == 0 {
+			primaryKdFile = kdFile
+		}
 
-func handleFormatCommand() {
-	dir := "."
-	if len(os.Args) > 2 {
-		dir = os.Args[2]
+		for _, b := range bs {
+			if _, ok := beadMap[b.Name]; ok {
+				if kdFile != primaryKdFile {
+					slog.Warn("Ignoring conflicting bead configuration", "bead", b.Name, "file", kdFile, "using", primaryKdFile)
+				} else {
+					beadMap[b.Name] = b
+					slog.Debug("Updated bead", "bead", b.Name, "file", kdFile)
+				}
+			} else {
+				beadMap[b.Name] = b
+				names = append(names, b.Name)
+				slog.Debug("Loaded bead", "bead", b.Name, "type", b.Type, "file", kdFile)
+			}
+		}
 	}
-	err := engine.FormatKDFilesInDir(dir)
-	if err != nil {
-		log.Fatalf("Error formatting .kd files: %v", err)
+
+	beads := make([]bead.Bead, 0, len(names))
+	for _, name := range names {
+		b := beadMap[name]
+		if _, err := bead.Lookup(b.Type); err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", b.Pos, err)
+		}
+		beads = append(beads, b)
 	}
-}
\ No newline at end of file
+	return beads, beadMap, nil
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/janpreet/kado/packages/bead"
+	"github.com/janpreet/kado/packages/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recorder is a bead handler that records the phases it runs, by bead name,
+// and the origin and inputs each bead was planned with.
+type recorder struct {
+	mu     sync.Mutex
+	calls  []string
+	inputs map[string]string
+}
+
+func (r *recorder) record(b bead.Bead, phase string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, b.Name+":"+phase)
+}
+
+func (r *recorder) Calls() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	calls := r.calls
+	r.calls = nil
+	r.inputs = nil
+	return calls
+}
+
+func (r *recorder) Inputs() map[string]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.inputs
+}
+
+func (r *recorder) Validate(b bead.Bead) error { return nil }
+
+func (r *recorder) Plan(ctx *bead.Context, b bead.Bead) error {
+	r.record(b, "plan")
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.inputs == nil {
+		r.inputs = make(map[string]string)
+	}
+	r.inputs[b.Name] = fmt.Sprintf("%s:%v", ctx.Origin, ctx.Inputs["from"])
+	return nil
+}
+
+func (r *recorder) Apply(ctx *bead.Context, b bead.Bead) error {
+	r.record(b, "apply")
+	return nil
+}
+
+func (r *recorder) Outputs(ctx *bead.Context, b bead.Bead) (map[string]interface{}, error) {
+	return map[string]interface{}{"from": b.Name}, nil
+}
+
+// destroyer is a recorder whose beads take part in `kado destroy`.
+type destroyer struct{ *recorder }
+
+func (destroyer) CanDestroy() bool { return true }
+
+var calls = &recorder{}
+
+func init() {
+	bead.Register("main_test", calls)
+	bead.Register("main_test_destroyer", destroyer{calls})
+}
+
+func testBead(name, beadType string, fields map[string]string) bead.Bead {
+	values := make(map[string]interface{}, len(fields))
+	for key, value := range fields {
+		values[key] = value
+	}
+	return bead.Bead{Name: name, Type: beadType, Fields: fields, Values: values}
+}
+
+func TestDestroyDoesNotFollowRelays(t *testing.T) {
+	infra := testBead("infra", "main_test_destroyer", map[string]string{"relay": "configure"})
+	beadMap := map[string]bead.Bead{
+		"infra":     infra,
+		"configure": testBead("configure", "main_test", nil),
+	}
+
+	r := newRun(nil, beadMap, true, report.New("apply"))
+	require.NoError(t, r.processBead(context.Background(), infra, nil, nil))
+	assert.Equal(t, []string{"infra:plan", "infra:apply", "configure:plan", "configure:apply"}, calls.Calls())
+
+	r = newRun(nil, beadMap, true, report.New("destroy"))
+	r.destroy = true
+	require.NoError(t, r.processBead(context.Background(), infra, nil, nil))
+	assert.Equal(t, []string{"infra:plan", "infra:apply"}, calls.Calls())
+}
+
+func TestApplyRelayOverrides(t *testing.T) {
+	tests := []struct {
+		name   string
+		values map[string]interface{}
+		target string
+		want   map[string]interface{}
+	}{
+		{
+			name:   "scoped keys",
+			values: map[string]interface{}{"relay_field": "configure.playbook=site.yaml,policy.path=policies"},
+			target: "configure",
+			want:   map[string]interface{}{"playbook": "site.yaml"},
+		},
+		{
+			name:   "unscoped keys apply to every target",
+			values: map[string]interface{}{"relay_field": "inventory=hosts.ini, playbook = base.yaml"},
+			target: "configure",
+			want:   map[string]interface{}{"inventory": "hosts.ini", "playbook": "base.yaml"},
+		},
+		{
+			name:   "scoped keys take precedence",
+			values: map[string]interface{}{"relay_field": "configure.playbook=site.yaml,playbook=base.yaml"},
+			target: "configure",
+			want:   map[string]interface{}{"playbook": "site.yaml"},
+		},
+		{
+			name:   "scoped keys of other targets",
+			values: map[string]interface{}{"relay_field": "policy.path=policies,playbook=base.yaml"},
+			target: "configure",
+			want:   map[string]interface{}{"playbook": "base.yaml"},
+		},
+		{
+			name: "block",
+			values: map[string]interface{}{"relay_field": map[string]interface{}{
+				"playbook":  "base.yaml",
+				"inventory": "hosts.ini",
+				"configure": map[string]interface{}{"playbook": "site.yaml"},
+				"policy":    map[string]interface{}{"path": "policies"},
+			}},
+			target: "configure",
+			want:   map[string]interface{}{"playbook": "site.yaml", "inventory": "hosts.ini"},
+		},
+		{
+			name:   "no relay_field",
+			target: "configure",
+			want:   map[string]interface{}{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := bead.Bead{Name: "compute", Fields: map[string]string{}, Values: tt.values}
+			if s, ok := tt.values["relay_field"].(string); ok {
+				b.Fields["relay_field"] = s
+			}
+			assert.Equal(t, tt.want, applyRelayOverrides(&b, tt.target))
+		})
+	}
+}
+
+func TestRelayedBead(t *testing.T) {
+	b := bead.Bead{Name: "compute", Values: map[string]interface{}{"relay_field": map[string]interface{}{
+		"configure": map[string]interface{}{
+			"playbook":   "site.yaml",
+			"limit":      []interface{}{"web", "db"},
+			"extra_vars": map[string]interface{}{"user": "ubuntu", "port": float64(22)},
+		},
+	}}}
+	target := testBead("configure", "main_test", map[string]string{"playbook": "base.yaml", "inventory": "hosts.ini"})
+
+	relayed := relayedBead(b, target)
+	assert.Equal(t, map[string]string{
+		"playbook":   "site.yaml",
+		"inventory":  "hosts.ini",
+		"limit":      "web,db",
+		"extra_vars": "port=22,user=ubuntu",
+	}, relayed.Fields)
+	assert.Equal(t, map[string]interface{}{"user": "ubuntu", "port": float64(22)}, relayed.Values["extra_vars"])
+	assert.Equal(t, "base.yaml", target.Fields["playbook"], "the target itself is not changed")
+}
+
+func TestRelayChainOrder(t *testing.T) {
+	beadMap := map[string]bead.Bead{
+		"compute":   testBead("compute", "main_test", map[string]string{"relay": "configure,notify"}),
+		"configure": testBead("configure", "main_test", map[string]string{"relay": "verify"}),
+		"verify":    testBead("verify", "main_test", nil),
+		"notify":    testBead("notify", "main_test", nil),
+	}
+
+	r := newRun(nil, beadMap, false, report.New("plan"))
+	require.NoError(t, r.processBead(context.Background(), beadMap["compute"], nil, nil))
+	inputs := calls.Inputs()
+	assert.Equal(t, []string{"compute:plan", "configure:plan", "verify:plan", "notify:plan"}, calls.Calls())
+	assert.Equal(t, map[string]string{
+		"compute":   ":<nil>",
+		"configure": "compute:compute",
+		"verify":    "configure:configure",
+		"notify":    "compute:compute",
+	}, inputs)
+}
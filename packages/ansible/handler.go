@@ -0,0 +1,90 @@
+package ansible
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/janpreet/kado/packages/bead"
+	"github.com/janpreet/kado/packages/engine"
+	"github.com/janpreet/kado/packages/render"
+)
+
+// Handler runs ansible beads.
+type Handler struct{}
+
+func init() {
+	bead.Register("ansible", Handler{})
+}
+
+// Schema declares the fields of ansible beads.
+func (Handler) Schema() []bead.Field {
+	return []bead.Field{
+		{Name: "playbook", Type: bead.TypeString, Required: true, Description: "Playbook to run, relative to the cloned source."},
+		{Name: "inventory", Type: bead.TypeString, Description: "Inventory passed to ansible-playbook. Defaults to the rendered inventory.ini."},
+		{Name: "extra_vars_file", Type: bead.TypeBool, Default: false, Description: "Pass the data file to the playbook as extra vars."},
+		{Name: "templates", Type: bead.TypeList, Description: "Templates rendered into the bead's own directory instead of the shared kado.templates list."},
+	}
+}
+
+func (Handler) Validate(b bead.Bead) error {
+	return nil
+}
+
+// Plan renders the templates and, outside of `set` mode, runs the playbook
+// with --check. A playbook relayed from OPA is only run once OPA allowed it.
+func (Handler) Plan(ctx *bead.Context, b bead.Bead) error {
+	ctx.Log().Info("Processing Ansible templates")
+	templates, ok := render.BeadTemplates(ctx.LandingZone, ctx.Data, b)
+	if !ok {
+		return fmt.Errorf("no templates defined for Ansible in the YAML configuration")
+	}
+	rendered, err := render.ProcessTemplates(templates, render.Values{Data: ctx.Data, Outputs: ctx.Outputs, Inputs: ctx.Inputs})
+	ctx.Result.AddRenderedFiles(rendered...)
+	if err != nil {
+		return fmt.Errorf("failed to process Ansible templates: %v", err)
+	}
+	relayToOPA := ctx.OriginType == "opa"
+	if relayToOPA {
+		ctx.Log().Info("Ansible bead is relayed to OPA for evaluation")
+	}
+	if err := checkPlaybook(ctx, b); err != nil {
+		return err
+	}
+	if ctx.Apply {
+		return nil
+	}
+	if relayToOPA {
+		ctx.Log().Info("Skipping Ansible playbook apply due to OPA evaluation or missing 'set' flag")
+		return nil
+	}
+	return runPlaybook(ctx, b)
+}
+
+func (Handler) Apply(ctx *bead.Context, b bead.Bead) error {
+	return runPlaybook(ctx, b)
+}
+
+func (Handler) Outputs(ctx *bead.Context, b bead.Bead) (map[string]interface{}, error) {
+	return map[string]interface{}{
+		"inventory": engine.InventoryPath(ctx, b),
+	}, nil
+}
+
+func checkPlaybook(ctx *bead.Context, b bead.Bead) error {
+	playbookPath := filepath.Join(ctx.LandingZone, b.Name, b.Fields["playbook"])
+	ctx.Log().Info("Running Ansible playbook", "playbook", playbookPath, "inventory", engine.InventoryPath(ctx, b))
+	if _, err := os.Stat(playbookPath); err != nil {
+		return fmt.Errorf("playbook file does not exist: %s", playbookPath)
+	}
+	return nil
+}
+
+func runPlaybook(ctx *bead.Context, b bead.Bead) error {
+	extraVarsFile := b.Fields["extra_vars_file"] == "true"
+	err := engine.HandleAnsible(ctx, b, []map[string]interface{}{ctx.Data}, extraVarsFile)
+	if err != nil {
+		return fmt.Errorf("failed to run Ansible: %v", err)
+	}
+	return nil
+}
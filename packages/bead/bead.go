@@ -1,7 +1,81 @@
 package bead
 
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/janpreet/kado/packages/kd"
+)
+
 type Bead struct {
-	Name    string            `yaml:"name"`
+	// Name identifies the bead instance. It defaults to the type, so
+	// `bead "terraform" {}` and `bead "terraform" "terraform" {}` are the same.
+	Name string `yaml:"name"`
+	// Type selects the registered handler, e.g. "terraform".
+	Type    string            `yaml:"type"`
 	Enabled *bool             `yaml:"enabled"`
 	Fields  map[string]string `yaml:"fields"`
+	// Values holds the typed form of every field as parsed from the .kd file.
+	Values map[string]interface{} `yaml:"-"`
+	// Pos is where the bead block starts; FieldPos records each field.
+	Pos      kd.Pos            `yaml:"-"`
+	FieldPos map[string]kd.Pos `yaml:"-"`
+}
+
+// FieldError is returned by a handler's Validate for a problem with one
+// field of a bead, so that it can be reported at the field's position in the
+// .kd file. Several of them are combined with errors.Join.
+type FieldError struct {
+	Field string
+	Msg   string
+}
+
+func (e *FieldError) Error() string {
+	return e.Msg
+}
+
+// Position returns where a field is set in the .kd file, or where the bead
+// starts when the field is not set.
+func (b Bead) Position(field string) kd.Pos {
+	if pos, ok := b.FieldPos[field]; ok {
+		return pos
+	}
+	return b.Pos
+}
+
+// List returns a list field. Lists written as `["a", "b"]` and comma
+// separated strings such as "a,b" are both accepted.
+func (b Bead) List(key string) []string {
+	if values, ok := b.Values[key].([]interface{}); ok {
+		list := make([]string, 0, len(values))
+		for _, v := range values {
+			list = append(list, fmt.Sprintf("%v", v))
+		}
+		return list
+	}
+	var list []string
+	for _, item := range strings.Split(b.Fields[key], ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// sensitiveFieldRegex matches the names of fields that may hold credentials,
+// such as extra_vars or a password.
+var sensitiveFieldRegex = regexp.MustCompile(`(?i)pass|secret|token|key|credential|auth|vars`)
+
+// LogFields returns the fields of b for debug logs, with the values of the
+// fields that may hold credentials redacted.
+func (b Bead) LogFields() map[string]string {
+	fields := make(map[string]string, len(b.Fields))
+	for name, value := range b.Fields {
+		if sensitiveFieldRegex.MatchString(name) && value != "" {
+			value = "<redacted>"
+		}
+		fields[name] = value
+	}
+	return fields
 }
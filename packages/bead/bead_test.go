@@ -15,3 +15,87 @@ func TestBeadCreation(t *testing.T) {
 	assert.Equal(t, "test_bead", bead.Name)
 	assert.Equal(t, "value", bead.Fields["key"])
 }
+
+type noopHandler struct{}
+
+func (noopHandler) Validate(b Bead) error            { return nil }
+func (noopHandler) Plan(ctx *Context, b Bead) error  { return nil }
+func (noopHandler) Apply(ctx *Context, b Bead) error { return nil }
+func (noopHandler) Outputs(ctx *Context, b Bead) (map[string]interface{}, error) {
+	return nil, nil
+}
+
+func TestRegistry(t *testing.T) {
+	Register("test_registry", noopHandler{})
+
+	h, err := Lookup("test_registry")
+	assert.NoError(t, err)
+	assert.NotNil(t, h)
+	assert.Contains(t, Registered(), "test_registry")
+
+	_, err = Lookup("missing")
+	assert.EqualError(t, err, `unknown bead type "missing" (registered types: test_registry)`)
+
+	assert.Panics(t, func() { Register("test_registry", noopHandler{}) })
+}
+
+type schemaHandler struct{ noopHandler }
+
+func (schemaHandler) Validate(b Bead) error {
+	if b.Fields["mode"] == "bad" {
+		return &FieldError{Field: "mode", Msg: "unknown mode"}
+	}
+	return nil
+}
+
+func (schemaHandler) Schema() []Field {
+	return []Field{
+		{Name: "playbook", Type: TypeString, Required: true, Description: "Playbook to run."},
+		{Name: "mode", Type: TypeString, Default: "check"},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	b := Bead{Name: "configure", Type: "ansible", Fields: map[string]string{"mode": "bad"}}
+	err := Validate(schemaHandler{}, b)
+	assert.EqualError(t, err, "ansible bead configure requires the \"playbook\" field\nunknown mode")
+
+	b.Fields = map[string]string{"playbook": "site.yaml"}
+	assert.NoError(t, Validate(schemaHandler{}, b))
+	assert.NoError(t, Validate(noopHandler{}, Bead{}))
+}
+
+func TestJSONSchema(t *testing.T) {
+	fields, ok := Schema(schemaHandler{})
+	assert.True(t, ok)
+	assert.Len(t, fields, len(CommonFields)+2)
+	_, ok = Schema(noopHandler{})
+	assert.False(t, ok)
+
+	schema := JSONSchema(fields)
+	assert.Equal(t, []string{"playbook"}, schema["required"])
+	assert.Equal(t, false, schema["additionalProperties"])
+	properties := schema["properties"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"type": "string", "description": "Playbook to run."}, properties["playbook"])
+	assert.Equal(t, "check", properties["mode"].(map[string]interface{})["default"])
+	assert.Equal(t, "boolean", properties["enabled"].(map[string]interface{})["type"])
+	assert.Contains(t, properties["relay"], "oneOf")
+}
+
+func TestLogFields(t *testing.T) {
+	b := Bead{Fields: map[string]string{
+		"playbook":        "site.yaml",
+		"extra_vars":      "db_password=hunter2",
+		"api_token":       "abc",
+		"pm_password":     "",
+		"extra_vars_file": "true",
+	}}
+	assert.Equal(t, map[string]string{
+		"playbook":        "site.yaml",
+		"extra_vars":      "<redacted>",
+		"api_token":       "<redacted>",
+		"pm_password":     "",
+		"extra_vars_file": "<redacted>",
+	}, b.LogFields())
+	assert.Equal(t, "db_password=hunter2", b.Fields["extra_vars"])
+}
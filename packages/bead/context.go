@@ -0,0 +1,96 @@
+package bead
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+
+	"github.com/janpreet/kado/packages/report"
+)
+
+// Context carries the run state shared with bead handlers. It embeds the
+// run's context.Context, which is cancelled when a sibling bead fails.
+type Context struct {
+	context.Context
+	// Data is the parsed cluster.yaml.
+	Data        map[string]interface{}
+	LandingZone string
+	// Apply is true when kado was invoked with `set`, or with
+	// `destroy --confirm`.
+	Apply bool
+	// Destroy is true for `kado destroy`. Handlers that implement Destroyer
+	// then plan and apply the removal of their resources.
+	Destroy bool
+	// Origin is the name of the bead that relayed to this one, if any, and
+	// OriginType is its bead type.
+	Origin     string
+	OriginType string
+	// Inputs holds the outputs the origin passed on. A bead relayed through an
+	// OPA gate receives the outputs of the bead the gate approved.
+	Inputs map[string]interface{}
+	// Outputs holds the outputs of every bead processed so far, by bead name.
+	Outputs map[string]map[string]interface{}
+	// Stdout and Stderr receive the output of the processes the bead starts.
+	// They default to os.Stdout and os.Stderr.
+	Stdout io.Writer
+	Stderr io.Writer
+	// Logger receives the bead's diagnostics. It defaults to slog.Default.
+	Logger *slog.Logger
+	// Result is the bead's entry in the run report. Handlers record rendered
+	// files, plans and policy decisions on it; it may be nil.
+	Result *report.Bead
+
+	phase string
+}
+
+// SetPhase records the lifecycle phase (clone, plan, apply, ...) that later
+// log records of the bead are tagged with.
+func (c *Context) SetPhase(phase string) {
+	c.phase = phase
+}
+
+// Log returns the bead's logger, tagged with the current phase.
+func (c *Context) Log() *slog.Logger {
+	l := c.Logger
+	if l == nil {
+		l = slog.Default()
+	}
+	if c.phase != "" {
+		l = l.With("phase", c.phase)
+	}
+	return l
+}
+
+func (c *Context) stdout() io.Writer {
+	if c.Stdout == nil {
+		return os.Stdout
+	}
+	return c.Stdout
+}
+
+func (c *Context) stderr() io.Writer {
+	if c.Stderr == nil {
+		return os.Stderr
+	}
+	return c.Stderr
+}
+
+// Command prepares a child process that is killed when the run is cancelled
+// and whose output goes to the bead's writers.
+func (c *Context) Command(dir, name string, args ...string) *exec.Cmd {
+	ctx := c.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	// Arguments may carry credentials, e.g. --extra-vars, so they are only
+	// logged at debug level.
+	c.Log().Info("Executing command", "command", name, "dir", dir)
+	c.Log().Debug("Command arguments", "command", name, "args", args)
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	cmd.Stdout = c.stdout()
+	cmd.Stderr = c.stderr()
+	return cmd
+}
@@ -0,0 +1,78 @@
+package bead
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// BeadHandler implements one bead type. Handlers register themselves with
+// Register from an init function in their own package.
+type BeadHandler interface {
+	// Validate checks that the bead carries the fields the handler needs,
+	// beyond the required fields of its schema, if it declares one.
+	Validate(b Bead) error
+	// Plan renders the bead's inputs and shows what would change.
+	Plan(ctx *Context, b Bead) error
+	// Apply makes the planned changes. It is only called in `set` mode.
+	Apply(ctx *Context, b Bead) error
+	// Outputs returns values produced by the bead for later beads.
+	Outputs(ctx *Context, b Bead) (map[string]interface{}, error)
+}
+
+// Destroyer is implemented by handlers whose resources `kado destroy` can
+// remove. When Context.Destroy is set their Plan saves a destroy plan and
+// Apply executes it; beads of other types are left alone.
+type Destroyer interface {
+	BeadHandler
+	CanDestroy() bool
+}
+
+// CanDestroy reports whether beads handled by h take part in `kado destroy`.
+func CanDestroy(h BeadHandler) bool {
+	d, ok := h.(Destroyer)
+	return ok && d.CanDestroy()
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]BeadHandler)
+)
+
+// Register makes a handler available under the given bead type name. It
+// panics if the name is already taken, like database/sql drivers do.
+func Register(name string, h BeadHandler) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if h == nil {
+		panic("bead: Register handler is nil")
+	}
+	if _, dup := registry[name]; dup {
+		panic("bead: Register called twice for handler " + name)
+	}
+	registry[name] = h
+}
+
+// Lookup returns the handler for a bead type.
+func Lookup(name string) (BeadHandler, error) {
+	registryMu.RLock()
+	h, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown bead type %q (registered types: %s)", name, strings.Join(Registered(), ", "))
+	}
+	return h, nil
+}
+
+// Registered returns the sorted names of all registered bead types.
+func Registered() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
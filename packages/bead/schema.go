@@ -0,0 +1,149 @@
+package bead
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/janpreet/kado/packages/kd"
+)
+
+// Field types of a bead schema. A list field also accepts a comma separated
+// string and a map field a block or a string of key=value pairs, the forms
+// Bead.List and relay_field read.
+const (
+	TypeString = "string"
+	TypeBool   = "bool"
+	TypeNumber = "number"
+	TypeList   = "list"
+	TypeMap    = "map"
+)
+
+// Field describes one field beads of a type accept.
+type Field struct {
+	Name        string      `json:"name"`
+	Type        string      `json:"type"`
+	Required    bool        `json:"required,omitempty"`
+	Default     interface{} `json:"default,omitempty"`
+	Description string      `json:"description"`
+}
+
+// Schemer is implemented by handlers that declare the fields of their
+// beads. Beads of other types accept any field.
+type Schemer interface {
+	BeadHandler
+	Schema() []Field
+}
+
+// CommonFields are accepted by beads of every type.
+var CommonFields = []Field{
+	{Name: "enabled", Type: TypeBool, Default: true, Description: "Whether the bead is processed."},
+	{Name: "source", Type: TypeString, Description: "Where the bead's files come from: a git repository, optionally as git::url//subdir?ref=v1.2&depth=1, a local directory or a tarball, fetched into the bead's directory in the LandingZone."},
+	{Name: "refs", Type: TypeString, Description: "Branch, tag or commit of source to check out."},
+	{Name: "depends_on", Type: TypeList, Description: "Beads that must finish before this one starts."},
+	{Name: "relay", Type: TypeList, Description: "Beads to relay to after this one, in order."},
+	{Name: "relay_field", Type: TypeMap, Description: "Overrides applied to the fields of the relay targets."},
+}
+
+// Schema returns the fields beads handled by h accept, the common fields
+// followed by the handler's own. ok is false if h declares no schema.
+func Schema(h BeadHandler) (fields []Field, ok bool) {
+	s, ok := h.(Schemer)
+	if !ok {
+		return nil, false
+	}
+	return append(append([]Field(nil), CommonFields...), s.Schema()...), true
+}
+
+// CheckValue reports whether a value parsed from a .kd file has the type of
+// the field.
+func (f Field) CheckValue(v *kd.Value) error {
+	var ok bool
+	switch f.Type {
+	case TypeString:
+		ok = v.Kind == kd.StringKind || v.Kind == kd.IdentKind || v.Kind == kd.NumberKind || v.Kind == kd.BoolKind
+	case TypeBool:
+		switch v.Kind {
+		case kd.BoolKind:
+			ok = true
+		case kd.StringKind, kd.IdentKind:
+			ok = v.Str == "true" || v.Str == "false"
+		}
+	case TypeNumber:
+		ok = v.Kind == kd.NumberKind
+	case TypeList:
+		ok = v.Kind == kd.ListKind || v.Kind == kd.StringKind || v.Kind == kd.IdentKind
+	case TypeMap:
+		ok = v.Kind == kd.MapKind || v.Kind == kd.StringKind
+	default:
+		ok = true
+	}
+	if !ok {
+		return fmt.Errorf("%s must be a %s, got %s", f.Name, f.Type, v.Kind)
+	}
+	return nil
+}
+
+// Validate checks that b sets the required fields of the schema of h and
+// then runs the handler's own Validate. It is called once relay overrides
+// are applied, since those may set required fields.
+func Validate(h BeadHandler, b Bead) error {
+	return errors.Join(checkRequired(h, b), h.Validate(b))
+}
+
+// checkRequired returns a *FieldError for every required field of the
+// schema of h that b does not set, combined with errors.Join.
+func checkRequired(h BeadHandler, b Bead) error {
+	fields, ok := Schema(h)
+	if !ok {
+		return nil
+	}
+	var errs []error
+	for _, f := range fields {
+		if f.Required && b.Fields[f.Name] == "" {
+			errs = append(errs, &FieldError{Field: f.Name, Msg: fmt.Sprintf("%s bead %s requires the %q field", b.Type, b.Name, f.Name)})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// JSONSchema describes beads with the given fields as a JSON Schema object,
+// for editors and other tools.
+func JSONSchema(fields []Field) map[string]interface{} {
+	properties := make(map[string]interface{}, len(fields))
+	required := []string{}
+	for _, f := range fields {
+		var property map[string]interface{}
+		switch f.Type {
+		case TypeBool:
+			property = map[string]interface{}{"type": "boolean"}
+		case TypeNumber:
+			property = map[string]interface{}{"type": "number"}
+		case TypeList:
+			property = map[string]interface{}{"oneOf": []interface{}{
+				map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+				map[string]interface{}{"type": "string", "description": "Comma separated list."},
+			}}
+		case TypeMap:
+			property = map[string]interface{}{"oneOf": []interface{}{
+				map[string]interface{}{"type": "object"},
+				map[string]interface{}{"type": "string", "description": "Comma separated key=value pairs."},
+			}}
+		default:
+			property = map[string]interface{}{"type": "string"}
+		}
+		property["description"] = f.Description
+		if f.Default != nil {
+			property["default"] = f.Default
+		}
+		properties[f.Name] = property
+		if f.Required {
+			required = append(required, f.Name)
+		}
+	}
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
@@ -1,17 +0,0 @@
-package config
-
-var ValidBeadNames = map[string]bool{
-	"ansible":   true,
-	"terraform": true,
-	"opa":       true,
-	"terragrunt":true,
-}
-
-func GetValidBeads() map[string]struct{} {
-	return map[string]struct{}{
-		"ansible":   {},
-		"terraform": {},
-		"opa":       {},
-		"terragrunt":{},
-	}
-}
@@ -1,74 +1,237 @@
 package config
 
 import (
-	"bufio"
 	"fmt"
-	"github.com/janpreet/kado/packages/bead"
-	"gopkg.in/yaml.v3"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
+
+	"github.com/janpreet/kado/packages/bead"
+	"github.com/janpreet/kado/packages/kd"
+	"gopkg.in/yaml.v3"
 )
 
 type YAMLConfig map[string]interface{}
 
 var LandingZone = "LandingZone"
-var TemplateDir = "templates"
+
+// TemplateDir, when set with --templates, replaces the kado.templates list
+// with every .tmpl file under the directory.
+var TemplateDir = ""
 var Debug bool = false
 
+// VendorDir is where kado vendor stores bead sources. With Offline, set by
+// --offline, sources are read from it and git never uses the network.
+var VendorDir = "vendor"
+var Offline = false
+
 const Version = "1.0.0"
 
 func LoadBeadsConfig(filename string) ([]bead.Bead, error) {
-	file, err := os.Open(filename)
+	f, err := kd.ParseFile(filename)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
+	return BeadsFromFile(f)
+}
 
+// BeadsFromFile converts the bead blocks of a parsed .kd file. Anything
+// other than a bead block at the top level is reported as an error.
+func BeadsFromFile(f *kd.File) ([]bead.Bead, error) {
 	var beads []bead.Bead
-	scanner := bufio.NewScanner(file)
-	var currentBead *bead.Bead
-	for scanner.Scan() {
-        line := strings.TrimSpace(scanner.Text())
-        if line == "" || strings.HasPrefix(line, "#") {
-            continue
-        }
-        if strings.HasPrefix(line, "bead \"") {
-            if currentBead != nil {
-                beads = append(beads, *currentBead)
-            }
-            currentBead = &bead.Bead{
-                Fields: make(map[string]string),
-            }
-            currentBead.Name = strings.Trim(line[6:], "\" {")
-            DebugPrint("DEBUG: Loading bead: %s\n", currentBead.Name)
-        } else if currentBead != nil {
-            parts := strings.SplitN(line, "=", 2)
-            if len(parts) != 2 {
-                continue
-            }
-            key := strings.TrimSpace(parts[0])
-            value := strings.Trim(strings.TrimSpace(parts[1]), "\"")
-			if strings.ToLower(key) == "enabled" {
-				enabled := strings.ToLower(value) == "true"
-				currentBead.Enabled = &enabled
-				DebugPrint("DEBUG: Set %s.Enabled = %v\n", currentBead.Name, *currentBead.Enabled)
-			} else {
-				currentBead.Fields[key] = value
+	var errs kd.ErrorList
+	errorf := func(pos kd.Pos, format string, a ...interface{}) {
+		errs = append(errs, &kd.Error{Pos: pos, Msg: fmt.Sprintf(format, a...)})
+	}
+
+	for _, item := range f.Body.Items {
+		switch n := item.(type) {
+		case *kd.Attribute:
+			errorf(n.NamePos, "unexpected attribute %q outside of a bead block", n.Name)
+		case *kd.Block:
+			if n.Type != "bead" {
+				errorf(n.TypePos, "unknown block type %q, expected \"bead\"", n.Type)
+				continue
 			}
-        }
-    }
-    if currentBead != nil {
-        beads = append(beads, *currentBead)
-    }
-	if err := scanner.Err(); err != nil {
-		return nil, err
+			if len(n.Labels) == 0 || len(n.Labels) > 2 {
+				errorf(n.TypePos, "bead block must have a type label and an optional name label, e.g. bead \"terraform\" \"network\"")
+				continue
+			}
+			name := n.Labels[len(n.Labels)-1]
+			var fields []bead.Field
+			hasSchema := false
+			if handler, err := bead.Lookup(n.Labels[0]); err == nil {
+				fields, hasSchema = bead.Schema(handler)
+			}
+			b := bead.Bead{
+				Name:     name,
+				Type:     n.Labels[0],
+				Fields:   make(map[string]string),
+				Values:   make(map[string]interface{}),
+				Pos:      n.TypePos,
+				FieldPos: make(map[string]kd.Pos),
+			}
+			for _, attr := range n.Attributes() {
+				b.FieldPos[attr.Name] = attr.NamePos
+				if strings.ToLower(attr.Name) == "enabled" {
+					enabled, ok := boolValue(attr.Value)
+					if !ok {
+						errorf(attr.Value.Pos, "enabled must be true or false, got %s", attr.Value.Kind)
+						continue
+					}
+					b.Enabled = &enabled
+					continue
+				}
+				if hasSchema {
+					field, ok := lookupField(fields, attr.Name)
+					if !ok {
+						errorf(attr.NamePos, "unknown field %q in %s bead %q%s", attr.Name, b.Type, b.Name, suggestField(fields, attr.Name))
+						continue
+					}
+					if err := field.CheckValue(attr.Value); err != nil {
+						errorf(attr.Value.Pos, "%v", err)
+						continue
+					}
+				}
+				b.Fields[attr.Name] = FieldString(attr.Value.Interface())
+				b.Values[attr.Name] = attr.Value.Interface()
+			}
+			for _, nested := range n.Blocks() {
+				if _, ok := b.Values[nested.Type]; ok {
+					errorf(nested.TypePos, "duplicate field %q in bead %q", nested.Type, b.Name)
+					continue
+				}
+				if hasSchema {
+					field, ok := lookupField(fields, nested.Type)
+					if !ok {
+						errorf(nested.TypePos, "unknown field %q in %s bead %q%s", nested.Type, b.Type, b.Name, suggestField(fields, nested.Type))
+						continue
+					}
+					if field.Type != bead.TypeMap {
+						errorf(nested.TypePos, "%s must be a %s, got a block", field.Name, field.Type)
+						continue
+					}
+				}
+				b.FieldPos[nested.Type] = nested.TypePos
+				values := blockValues(nested)
+				b.Values[nested.Type] = values
+				b.Fields[nested.Type] = FieldString(values)
+			}
+			for _, field := range fields {
+				if _, ok := b.Values[field.Name]; ok || field.Default == nil || field.Name == "enabled" {
+					continue
+				}
+				b.Fields[field.Name] = FieldString(field.Default)
+				b.Values[field.Name] = field.Default
+			}
+			beads = append(beads, b)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
 	}
 
-    for i, b := range beads {
-        DebugPrint("DEBUG: Loaded bead %s (index: %d) with enabled = %v\n", b.Name, i, b.Enabled)
-    }
+	return beads, nil
+}
 
-    return beads, nil
+func boolValue(v *kd.Value) (bool, bool) {
+	switch v.Kind {
+	case kd.BoolKind:
+		return v.Bool, true
+	case kd.StringKind, kd.IdentKind:
+		switch strings.ToLower(v.Str) {
+		case "true":
+			return true, true
+		case "false":
+			return false, true
+		}
+	}
+	return false, false
+}
+
+func lookupField(fields []bead.Field, name string) (bead.Field, bool) {
+	for _, field := range fields {
+		if field.Name == name {
+			return field, true
+		}
+	}
+	return bead.Field{}, false
+}
+
+// suggestField returns a hint naming the field closest to a misspelled one,
+// or nothing if no field is close.
+func suggestField(fields []bead.Field, name string) string {
+	best, bestDistance := "", 3
+	for _, field := range fields {
+		if d := editDistance(name, field.Name); d < bestDistance {
+			best, bestDistance = field.Name, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(", did you mean %q?", best)
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func blockValues(block *kd.Block) map[string]interface{} {
+	values := make(map[string]interface{})
+	for _, attr := range block.Attributes() {
+		values[attr.Name] = attr.Value.Interface()
+	}
+	for _, nested := range block.Blocks() {
+		values[nested.Type] = blockValues(nested)
+	}
+	return values
+}
+
+// FieldString flattens a value into the single-string form of bead fields:
+// list items joined with commas and maps as comma separated key=value pairs
+// in key order, nested values flattened the same way.
+func FieldString(value interface{}) string {
+	switch value := value.(type) {
+	case []interface{}:
+		items := make([]string, len(value))
+		for i, item := range value {
+			items[i] = FieldString(item)
+		}
+		return strings.Join(items, ",")
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		pairs := make([]string, len(keys))
+		for i, key := range keys {
+			pairs[i] = key + "=" + FieldString(value[key])
+		}
+		return strings.Join(pairs, ",")
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	return fmt.Sprintf("%v", value)
 }
 
 func LoadYAMLConfig(filename string) (map[string]interface{}, error) {
@@ -86,10 +249,6 @@ func LoadYAMLConfig(filename string) (map[string]interface{}, error) {
 	return config, nil
 }
 
-func GetValidBeadNames() map[string]struct{} {
-	return GetValidBeads()
-}
-
 func GetValidBeadsWithDefaultEnabled(beads []bead.Bead) ([]bead.Bead, map[string]string) {
     var validBeads []bead.Bead
     invalidBeadReasons := make(map[string]string)
@@ -100,8 +259,6 @@ func GetValidBeadsWithDefaultEnabled(beads []bead.Bead) ([]bead.Bead, map[string
             b.Enabled = &defaultEnabled
         }
         
-        DebugPrint("DEBUG: Validating bead %s (Enabled: %v)\n", b.Name, *b.Enabled)
-        
         if *b.Enabled {
             validBeads = append(validBeads, b)
         } else {
@@ -111,9 +268,3 @@ func GetValidBeadsWithDefaultEnabled(beads []bead.Bead) ([]bead.Bead, map[string
 
     return validBeads, invalidBeadReasons
 }
-
-func DebugPrint(format string, a ...interface{}) {
-    if Debug {
-        fmt.Printf(format, a...)
-    }
-}
\ No newline at end of file
@@ -0,0 +1,147 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/janpreet/kado/packages/bead"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeKd(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.kd")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestLoadBeadsConfigNamedInstances(t *testing.T) {
+	path := writeKd(t, `bead "terraform" {
+  source = "git@github.com:org/default.git"
+}
+
+bead "terraform" "network" {
+  source = "git@github.com:org/network.git"
+  enabled = false
+  relay = "network-policy"
+}
+`)
+	beads, err := LoadBeadsConfig(path)
+	require.NoError(t, err)
+	require.Len(t, beads, 2)
+
+	assert.Equal(t, "terraform", beads[0].Name)
+	assert.Equal(t, "terraform", beads[0].Type)
+	assert.Nil(t, beads[0].Enabled)
+
+	assert.Equal(t, "network", beads[1].Name)
+	assert.Equal(t, "terraform", beads[1].Type)
+	assert.False(t, *beads[1].Enabled)
+	assert.Equal(t, "network-policy", beads[1].Fields["relay"])
+	assert.Equal(t, 8, beads[1].FieldPos["relay"].Line)
+}
+
+func TestLoadBeadsConfigReportsPositions(t *testing.T) {
+	path := writeKd(t, `name = "stray"
+module "x" {
+}
+bead "opa" {
+  enabled = "maybe"
+}
+`)
+	_, err := LoadBeadsConfig(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), path+`:1:1: unexpected attribute "name" outside of a bead block`)
+	assert.Contains(t, err.Error(), path+`:2:1: unknown block type "module", expected "bead"`)
+	assert.Contains(t, err.Error(), path+`:5:13: enabled must be true or false, got string`)
+}
+
+type schemaHandler struct{}
+
+func (schemaHandler) Validate(b bead.Bead) error                 { return nil }
+func (schemaHandler) Plan(ctx *bead.Context, b bead.Bead) error  { return nil }
+func (schemaHandler) Apply(ctx *bead.Context, b bead.Bead) error { return nil }
+func (schemaHandler) Outputs(ctx *bead.Context, b bead.Bead) (map[string]interface{}, error) {
+	return nil, nil
+}
+func (schemaHandler) Schema() []bead.Field {
+	return []bead.Field{
+		{Name: "playbook", Type: bead.TypeString, Required: true},
+		{Name: "retries", Type: bead.TypeNumber, Default: 3},
+		{Name: "check", Type: bead.TypeBool, Default: false},
+	}
+}
+
+func init() {
+	bead.Register("config_schema_test", schemaHandler{})
+}
+
+func TestLoadBeadsConfigEnforcesSchema(t *testing.T) {
+	path := writeKd(t, `bead "config_schema_test" "configure" {
+  playbok = "site.yaml"
+  retries = "many"
+  check   = "yes"
+  relay_field {
+    policy {
+      package = "data.x"
+    }
+  }
+  playbook {
+  }
+}
+`)
+	_, err := LoadBeadsConfig(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), path+`:2:3: unknown field "playbok" in config_schema_test bead "configure", did you mean "playbook"?`)
+	assert.Contains(t, err.Error(), path+`:3:13: retries must be a number, got string`)
+	assert.Contains(t, err.Error(), path+`:4:13: check must be a bool, got string`)
+	assert.Contains(t, err.Error(), path+`:10:3: playbook must be a string, got a block`)
+	assert.NotContains(t, err.Error(), "relay_field")
+}
+
+func TestLoadBeadsConfigAppliesDefaults(t *testing.T) {
+	path := writeKd(t, `bead "config_schema_test" "configure" {
+  playbook = "site.yaml"
+  check    = true
+}
+`)
+	beads, err := LoadBeadsConfig(path)
+	require.NoError(t, err)
+	require.Len(t, beads, 1)
+	assert.Equal(t, "3", beads[0].Fields["retries"])
+	assert.Equal(t, 3, beads[0].Values["retries"])
+	assert.Equal(t, "true", beads[0].Fields["check"])
+	assert.Nil(t, beads[0].Enabled)
+}
+
+func TestFieldString(t *testing.T) {
+	assert.Equal(t, "web", FieldString("web"))
+	assert.Equal(t, "2.5", FieldString(2.5))
+	assert.Equal(t, "true", FieldString(true))
+	assert.Equal(t, "web,db,22", FieldString([]interface{}{"web", []interface{}{"db", float64(22)}}))
+	assert.Equal(t, "port=22,tags=web,db,user=ubuntu", FieldString(map[string]interface{}{
+		"user": "ubuntu",
+		"port": float64(22),
+		"tags": []interface{}{"web", "db"},
+	}))
+	assert.Equal(t, "limits=cpu=2,mem=4096,name=vm", FieldString(map[string]interface{}{
+		"name":   "vm",
+		"limits": map[string]interface{}{"mem": float64(4096), "cpu": float64(2)},
+	}))
+
+	path := writeKd(t, `bead "ansible" "configure" {
+  tags = ["web", ["db", 22]]
+  extra_vars {
+    user = "ubuntu"
+    port = 22
+  }
+}
+`)
+	beads, err := LoadBeadsConfig(path)
+	require.NoError(t, err)
+	require.Len(t, beads, 1)
+	assert.Equal(t, "web,db,22", beads[0].Fields["tags"])
+	assert.Equal(t, "port=22,user=ubuntu", beads[0].Fields["extra_vars"])
+}
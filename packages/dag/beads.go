@@ -0,0 +1,41 @@
+package dag
+
+import (
+	"fmt"
+
+	"github.com/janpreet/kado/packages/bead"
+)
+
+// FromBeads builds the execution graph of a set of beads. A bead runs after
+// every bead listed in its depends_on field and after any bead relaying to
+// it. Disabled beads stay in the graph so references to them resolve.
+func FromBeads(beads []bead.Bead) (*Graph, error) {
+	g := New()
+	names := make(map[string]bool, len(beads))
+	for _, b := range beads {
+		g.AddNode(b.Name)
+		names[b.Name] = true
+	}
+
+	for _, b := range beads {
+		for _, dep := range b.List("depends_on") {
+			if !names[dep] {
+				return nil, fmt.Errorf("%s: bead %s depends on unknown bead %q", b.FieldPos["depends_on"], b.Name, dep)
+			}
+			if dep == b.Name {
+				return nil, fmt.Errorf("%s: bead %s depends on itself", b.FieldPos["depends_on"], b.Name)
+			}
+			g.AddEdge(dep, b.Name)
+		}
+		for _, relay := range b.List("relay") {
+			if names[relay] {
+				g.AddEdge(b.Name, relay)
+			}
+		}
+	}
+
+	if _, err := g.Stages(); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
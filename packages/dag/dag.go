@@ -0,0 +1,176 @@
+// Package dag orders beads by their dependencies.
+package dag
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Graph is a directed acyclic graph of named nodes. An edge from A to B
+// means A must finish before B starts.
+type Graph struct {
+	order []string
+	deps  map[string][]string
+	next  map[string][]string
+}
+
+func New() *Graph {
+	return &Graph{
+		deps: make(map[string][]string),
+		next: make(map[string][]string),
+	}
+}
+
+// AddNode adds a node. Nodes are ordered by insertion when the graph allows
+// several valid orderings, which keeps runs reproducible.
+func (g *Graph) AddNode(name string) {
+	if _, ok := g.deps[name]; ok {
+		return
+	}
+	g.order = append(g.order, name)
+	g.deps[name] = nil
+}
+
+// AddEdge records that from must run before to.
+func (g *Graph) AddEdge(from, to string) {
+	g.AddNode(from)
+	g.AddNode(to)
+	for _, d := range g.deps[to] {
+		if d == from {
+			return
+		}
+	}
+	g.deps[to] = append(g.deps[to], from)
+	g.next[from] = append(g.next[from], to)
+}
+
+// Nodes returns every node in insertion order.
+func (g *Graph) Nodes() []string {
+	return append([]string(nil), g.order...)
+}
+
+// Dependencies returns the nodes that must finish before name.
+func (g *Graph) Dependencies(name string) []string {
+	return append([]string(nil), g.deps[name]...)
+}
+
+// Dependents returns the nodes that wait for name.
+func (g *Graph) Dependents(name string) []string {
+	return append([]string(nil), g.next[name]...)
+}
+
+// Reverse returns a copy of the graph with every edge flipped, so that a
+// node runs only after everything that depended on it. Insertion order is
+// kept.
+func (g *Graph) Reverse() *Graph {
+	r := New()
+	for _, name := range g.order {
+		r.AddNode(name)
+	}
+	for _, name := range g.order {
+		for _, dep := range g.deps[name] {
+			r.AddEdge(name, dep)
+		}
+	}
+	return r
+}
+
+// Sort returns the nodes in a topological order.
+func (g *Graph) Sort() ([]string, error) {
+	stages, err := g.Stages()
+	if err != nil {
+		return nil, err
+	}
+	var sorted []string
+	for _, stage := range stages {
+		sorted = append(sorted, stage...)
+	}
+	return sorted, nil
+}
+
+// Stages groups the nodes into levels. Every node in a stage only depends on
+// nodes from earlier stages, so the nodes within a stage are independent.
+func (g *Graph) Stages() ([][]string, error) {
+	remaining := make(map[string]int, len(g.order))
+	for _, name := range g.order {
+		remaining[name] = len(g.deps[name])
+	}
+
+	var stages [][]string
+	done := 0
+	for done < len(g.order) {
+		var stage []string
+		for _, name := range g.order {
+			if remaining[name] == 0 {
+				stage = append(stage, name)
+			}
+		}
+		if len(stage) == 0 {
+			return nil, g.cycleError(remaining)
+		}
+		for _, name := range stage {
+			remaining[name] = -1
+			for _, n := range g.next[name] {
+				remaining[n]--
+			}
+		}
+		done += len(stage)
+		stages = append(stages, stage)
+	}
+	return stages, nil
+}
+
+// CycleError reports a dependency cycle such as a -> b -> a.
+type CycleError struct {
+	Cycle []string
+}
+
+func (e *CycleError) Error() string {
+	return fmt.Sprintf("dependency cycle detected: %s", strings.Join(e.Cycle, " -> "))
+}
+
+// cycleError walks the nodes left over by Stages to find one concrete cycle.
+func (g *Graph) cycleError(remaining map[string]int) error {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int)
+	var stack []string
+	var cycle []string
+
+	var visit func(name string) bool
+	visit = func(name string) bool {
+		state[name] = visiting
+		stack = append(stack, name)
+		for _, n := range g.next[name] {
+			if remaining[n] <= 0 {
+				continue
+			}
+			switch state[n] {
+			case visiting:
+				for i, s := range stack {
+					if s == n {
+						cycle = append(append([]string(nil), stack[i:]...), n)
+						return true
+					}
+				}
+			case unvisited:
+				if visit(n) {
+					return true
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[name] = visited
+		return false
+	}
+
+	for _, name := range g.order {
+		if remaining[name] > 0 && state[name] == unvisited && visit(name) {
+			return &CycleError{Cycle: cycle}
+		}
+	}
+	return &CycleError{}
+}
@@ -0,0 +1,163 @@
+package dag
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/janpreet/kado/packages/bead"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStagesKeepInsertionOrder(t *testing.T) {
+	g := New()
+	g.AddNode("dns")
+	g.AddNode("network")
+	g.AddNode("compute")
+	g.AddEdge("network", "compute")
+	g.AddEdge("dns", "compute")
+
+	stages, err := g.Stages()
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"dns", "network"}, {"compute"}}, stages)
+
+	order, err := g.Sort()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dns", "network", "compute"}, order)
+}
+
+func TestReverse(t *testing.T) {
+	g := New()
+	g.AddNode("dns")
+	g.AddEdge("network", "compute")
+	g.AddEdge("dns", "compute")
+
+	stages, err := g.Reverse().Stages()
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"compute"}, {"dns", "network"}}, stages)
+	assert.Equal(t, []string{"network", "dns"}, g.Dependencies("compute"))
+}
+
+func TestCycleIsReported(t *testing.T) {
+	g := New()
+	g.AddNode("standalone")
+	g.AddEdge("a", "b")
+	g.AddEdge("b", "c")
+	g.AddEdge("c", "a")
+
+	_, err := g.Sort()
+	require.Error(t, err)
+	assert.EqualError(t, err, "dependency cycle detected: a -> b -> c -> a")
+}
+
+func TestFromBeads(t *testing.T) {
+	beads := []bead.Bead{
+		{Name: "ansible", Values: map[string]interface{}{"depends_on": []interface{}{"network"}}},
+		{Name: "network", Fields: map[string]string{"relay": "opa"}},
+		{Name: "opa"},
+	}
+	g, err := FromBeads(beads)
+	require.NoError(t, err)
+
+	order, err := g.Sort()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"network", "ansible", "opa"}, order)
+	assert.Equal(t, []string{"network"}, g.Dependencies("opa"))
+
+	_, err = FromBeads([]bead.Bead{{Name: "a", Fields: map[string]string{"depends_on": "missing"}}})
+	assert.ErrorContains(t, err, `bead a depends on unknown bead "missing"`)
+
+	_, err = FromBeads([]bead.Bead{
+		{Name: "a", Fields: map[string]string{"depends_on": "b", "relay": "b"}},
+		{Name: "b"},
+	})
+	assert.EqualError(t, err, "dependency cycle detected: a -> b -> a")
+}
+
+func TestFromBeadsRelayList(t *testing.T) {
+	beads := []bead.Bead{
+		{Name: "configure", Fields: map[string]string{}},
+		{Name: "compute", Values: map[string]interface{}{"relay": []interface{}{"policy", "notify"}}},
+		{Name: "policy", Fields: map[string]string{"relay": "configure"}},
+		{Name: "notify"},
+	}
+	g, err := FromBeads(beads)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"compute"}, g.Dependencies("notify"))
+	assert.Equal(t, []string{"policy"}, g.Dependencies("configure"))
+
+	order, err := g.Sort()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"compute", "policy", "notify", "configure"}, order)
+}
+
+func TestRunParallelAndSkipsDependents(t *testing.T) {
+	g := New()
+	g.AddNode("terragrunt")
+	g.AddNode("ansible")
+	g.AddEdge("terragrunt", "opa")
+
+	var both sync.WaitGroup
+	both.Add(2)
+	var mu sync.Mutex
+	ran := map[string]bool{}
+	skipped := map[string]string{}
+
+	err := g.Run(context.Background(), RunOptions{
+		Parallelism: 2,
+		Skipped:     func(name string, reason error) { skipped[name] = reason.Error() },
+	}, func(ctx context.Context, name string) error {
+		mu.Lock()
+		ran[name] = true
+		mu.Unlock()
+		if name != "opa" {
+			// Both independent beads must be running at the same time.
+			both.Done()
+			both.Wait()
+		}
+		if name == "terragrunt" {
+			return errors.New("plan failed")
+		}
+		return nil
+	})
+
+	assert.EqualError(t, err, "terragrunt: plan failed")
+	assert.True(t, ran["ansible"])
+	assert.False(t, ran["opa"])
+	assert.Equal(t, map[string]string{"opa": "dependency terragrunt failed"}, skipped)
+}
+
+func TestRunFailFastCancelsSiblings(t *testing.T) {
+	g := New()
+	g.AddNode("slow")
+	g.AddNode("broken")
+	g.AddEdge("slow", "after")
+
+	var mu sync.Mutex
+	ran := map[string]bool{}
+	skipped := map[string]string{}
+
+	err := g.Run(context.Background(), RunOptions{
+		Parallelism: 2,
+		FailFast:    true,
+		Skipped:     func(name string, reason error) { skipped[name] = reason.Error() },
+	}, func(ctx context.Context, name string) error {
+		mu.Lock()
+		ran[name] = true
+		mu.Unlock()
+		if name == "broken" {
+			return errors.New("boom")
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "broken: boom")
+	assert.Contains(t, err.Error(), "slow: context canceled")
+	assert.True(t, ran["slow"])
+	assert.False(t, ran["after"])
+	assert.Equal(t, "dependency slow failed", skipped["after"])
+}
@@ -0,0 +1,124 @@
+package dag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// RunOptions controls how Run schedules nodes.
+type RunOptions struct {
+	// Parallelism is the maximum number of nodes running at once. Values
+	// below 1 are treated as 1.
+	Parallelism int
+	// FailFast cancels the nodes still running and starts no new ones after
+	// the first failure. Otherwise only the dependents of a failed node are
+	// skipped and independent branches run to completion.
+	FailFast bool
+	// Skipped, if set, is called for every node that never ran, with the
+	// reason it was skipped.
+	Skipped func(name string, reason error)
+}
+
+// Run calls fn for every node once all of its dependencies have succeeded,
+// running up to opts.Parallelism nodes concurrently. Ready nodes start in
+// insertion order. The returned error joins the errors of all failed nodes.
+func (g *Graph) Run(ctx context.Context, opts RunOptions, fn func(ctx context.Context, name string) error) error {
+	if _, err := g.Stages(); err != nil {
+		return err
+	}
+	parallelism := opts.Parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	index := make(map[string]int, len(g.order))
+	pending := make(map[string]int, len(g.order))
+	for i, name := range g.order {
+		index[name] = i
+		pending[name] = len(g.deps[name])
+	}
+
+	type result struct {
+		name string
+		err  error
+	}
+	results := make(chan result)
+	finished := make(map[string]bool, len(g.order))
+	skip := func(name string, reason error) {
+		if finished[name] {
+			return
+		}
+		finished[name] = true
+		if opts.Skipped != nil {
+			opts.Skipped(name, reason)
+		}
+	}
+	var skipDependents func(name string, reason error)
+	skipDependents = func(name string, reason error) {
+		for _, n := range g.next[name] {
+			if !finished[n] {
+				skip(n, reason)
+				skipDependents(n, reason)
+			}
+		}
+	}
+
+	var ready []string
+	push := func(name string) {
+		i := len(ready)
+		for i > 0 && index[ready[i-1]] > index[name] {
+			i--
+		}
+		ready = append(ready, "")
+		copy(ready[i+1:], ready[i:])
+		ready[i] = name
+	}
+	for _, name := range g.order {
+		if pending[name] == 0 {
+			push(name)
+		}
+	}
+
+	var errs []error
+	running := 0
+	for {
+		for running < parallelism && len(ready) > 0 && ctx.Err() == nil {
+			name := ready[0]
+			ready = ready[1:]
+			running++
+			go func() {
+				results <- result{name: name, err: fn(ctx, name)}
+			}()
+		}
+		if running == 0 {
+			break
+		}
+
+		r := <-results
+		running--
+		finished[r.name] = true
+		if r.err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", r.name, r.err))
+			skipDependents(r.name, fmt.Errorf("dependency %s failed", r.name))
+			if opts.FailFast {
+				cancel()
+			}
+			continue
+		}
+		for _, n := range g.next[r.name] {
+			pending[n]--
+			if pending[n] == 0 && !finished[n] {
+				push(n)
+			}
+		}
+	}
+
+	for _, name := range g.order {
+		skip(name, errors.New("run cancelled"))
+	}
+	return errors.Join(errs...)
+}
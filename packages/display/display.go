@@ -2,7 +2,11 @@ package display
 
 import (
 	"fmt"
+	"sort"
+	"strings"
+
 	"github.com/janpreet/kado/packages/bead"
+	"github.com/janpreet/kado/packages/dag"
 )
 
 func DisplayBeads(kdBeads map[string]bead.Bead, parsedYAMLs []map[string]interface{}) {
@@ -34,50 +38,52 @@ func DisplayTemplateOutput(outputPath string) {
 	fmt.Printf("Template processed successfully. Output written to: %s\n", outputPath)
 }
 
-func DisplayBead(b bead.Bead) {
-	fmt.Printf("Bead: %s\n", b.Name)
-	for key, value := range b.Fields {
-		fmt.Printf("  %s = %s\n", key, value)
-	}
-}
-
-func DisplayBeadConfig(beads []bead.Bead) {
+// DisplayBeadConfig prints the execution graph stage by stage. Beads in the
+// same stage do not depend on each other.
+func DisplayBeadConfig(beads []bead.Bead, graph *dag.Graph) {
 	fmt.Println("Bead Configuration and Order of Execution:")
 
-	displayed := make(map[string]bool)
+	stages, err := graph.Stages()
+	if err != nil {
+		fmt.Printf("  %v\n", err)
+		return
+	}
+
+	byName := make(map[string]bead.Bead, len(beads))
+	for _, b := range beads {
+		byName[b.Name] = b
+	}
 
-	var displayBeadChain func(string)
-	displayBeadChain = func(name string) {
-		if displayed[name] {
-			return
+	for i, stage := range stages {
+		if i > 0 {
+			fmt.Println("↓")
 		}
-		for _, b := range beads {
-			if b.Name == name {
-				if displayed[name] {
-					continue
-				}
-				if len(displayed) > 0 {
-					fmt.Println("↓")
-				}
-				fmt.Printf("Bead: %s\n", b.Name)
-				for key, value := range b.Fields {
-					fmt.Printf("  %s = %s\n", key, value)
-				}
-				displayed[name] = true
-				if relay, ok := b.Fields["relay"]; ok {
-					displayBeadChain(relay)
-				}
-				break
+		fmt.Printf("Stage %d:\n", i+1)
+		for _, name := range stage {
+			b := byName[name]
+			label := beadLabel(b)
+			if b.Enabled != nil && !*b.Enabled {
+				label += " [disabled]"
+			}
+			fmt.Printf("  Bead: %s\n", label)
+			if deps := graph.Dependencies(name); len(deps) > 0 {
+				fmt.Printf("    after: %s\n", strings.Join(deps, ", "))
+			}
+			keys := make([]string, 0, len(b.Fields))
+			for key := range b.Fields {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				fmt.Printf("    %s = %s\n", key, b.Fields[key])
 			}
 		}
 	}
+}
 
-	for _, b := range beads {
-		if !displayed[b.Name] {
-			if len(displayed) > 0 {
-				fmt.Println()
-			}
-			displayBeadChain(b.Name)
-		}
+func beadLabel(b bead.Bead) string {
+	if b.Type != "" && b.Type != b.Name {
+		return fmt.Sprintf("%s (%s)", b.Name, b.Type)
 	}
+	return b.Name
 }
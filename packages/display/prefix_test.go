@@ -0,0 +1,22 @@
+package display
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	var out bytes.Buffer
+	w := NewPrefixWriter(&out, "[terraform] ")
+
+	_, err := w.Write([]byte("Initializing...\nPlan: 1 to"))
+	assert.NoError(t, err)
+	assert.Equal(t, "[terraform] Initializing...\n", out.String())
+
+	_, err = w.Write([]byte(" add\npartial"))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Flush())
+	assert.Equal(t, "[terraform] Initializing...\n[terraform] Plan: 1 to add\n[terraform] partial\n", out.String())
+}
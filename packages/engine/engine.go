@@ -1,33 +1,34 @@
 package engine
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 
 	"github.com/janpreet/kado/packages/bead"
-	"github.com/janpreet/kado/packages/config"
 	"github.com/janpreet/kado/packages/render"
 )
 
-func isDryRun() bool {
-	if len(os.Args) > 1 && os.Args[1] == "set" {
-		return false
+// InventoryPath returns the inventory of an ansible bead: its inventory
+// field, or the inventory.ini rendered for it. A bead with its own templates
+// renders it into its directory in the LandingZone, other beads share the
+// one in the LandingZone.
+func InventoryPath(ctx *bead.Context, b bead.Bead) string {
+	if inventory := b.Fields["inventory"]; inventory != "" {
+		return inventory
 	}
-	return true
+	if templates, ok := render.BeadTemplates(ctx.LandingZone, ctx.Data, b); ok && templates.Own {
+		return filepath.Join(templates.Dir, "inventory.ini")
+	}
+	return filepath.Join(ctx.LandingZone, "inventory.ini")
 }
 
-func HandleAnsible(b bead.Bead, yamlData []map[string]interface{}, extraVarsFile bool) error {
-	dryRun := isDryRun()
+func HandleAnsible(ctx *bead.Context, b bead.Bead, yamlData []map[string]interface{}, extraVarsFile bool) error {
+	dryRun := !ctx.Apply
 
 	playbook := b.Fields["playbook"]
-	inventory := b.Fields["inventory"]
-	if inventory == "" {
-		inventory = filepath.Join(config.LandingZone, "inventory.ini")
-	}
-
-	args := []string{"-i", inventory}
+	args := []string{"-i", InventoryPath(ctx, b)}
 	if extraVarsFile {
 		extraVarsPath, err := render.WriteExtraVarsFile(yamlData, "yaml")
 		if err != nil {
@@ -35,18 +36,37 @@ func HandleAnsible(b bead.Bead, yamlData []map[string]interface{}, extraVarsFile
 		}
 		args = append(args, "--extra-vars", "@"+extraVarsPath)
 	}
+	if len(ctx.Inputs) > 0 {
+		inputsPath, err := writeInputs(ctx, b)
+		if err != nil {
+			return err
+		}
+		args = append(args, "--extra-vars", "@"+inputsPath)
+	}
 	if dryRun {
 		args = append(args, "--check")
 	}
-	args = append(args, filepath.Join(config.LandingZone, b.Name, playbook))
+	args = append(args, filepath.Join(ctx.LandingZone, b.Name, playbook))
 
-	cmd := exec.Command("ansible-playbook", args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	err := cmd.Run()
+	err := ctx.Command("", "ansible-playbook", args...).Run()
 	if err != nil {
 		return fmt.Errorf("failed to run ansible playbook: %w", err)
 	}
 
 	return nil
 }
+
+// writeInputs saves the outputs the relaying bead passed on as the
+// kado_inputs extra var of the playbook, e.g. the IPs of the VMs terraform
+// just created, and returns the path of the file.
+func writeInputs(ctx *bead.Context, b bead.Bead) (string, error) {
+	content, err := json.Marshal(map[string]interface{}{"kado_inputs": ctx.Inputs})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode relay inputs: %w", err)
+	}
+	path := filepath.Join(ctx.LandingZone, b.Name+"-inputs.json")
+	if err := os.WriteFile(path, content, 0600); err != nil {
+		return "", fmt.Errorf("failed to write relay inputs: %w", err)
+	}
+	return path, nil
+}
@@ -1,12 +1,32 @@
 package engine
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/janpreet/kado/packages/bead"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestFormatKDFilesInDir(t *testing.T) {
 	err := FormatKDFilesInDir("../../")
 	assert.NoError(t, err)
 }
+
+func TestLintKDFilesInDir(t *testing.T) {
+	diags, err := LintKDFilesInDir("../../")
+	assert.NoError(t, err)
+	assert.Empty(t, diags)
+}
+
+func TestWriteInputs(t *testing.T) {
+	ctx := &bead.Context{LandingZone: t.TempDir(), Inputs: map[string]interface{}{"vm_ips": []interface{}{"10.0.0.1"}}}
+	path, err := writeInputs(ctx, bead.Bead{Name: "configure"})
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(ctx.LandingZone, "configure-inputs.json"), path)
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"kado_inputs": {"vm_ips": ["10.0.0.1"]}}`, string(content))
+}
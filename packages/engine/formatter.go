@@ -1,85 +1,36 @@
 package engine
 
 import (
-	"bufio"
 	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strings"
-)
 
+	"github.com/janpreet/kado/packages/kd"
+)
 
+// FormatKDFile rewrites a .kd file in canonical style. Files with syntax
+// errors are left untouched and the errors are returned with positions.
 func FormatKDFile(filePath string) error {
-	file, err := os.Open(filePath)
+	src, err := os.ReadFile(filePath)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
-
-	var formattedLines []string
-	scanner := bufio.NewScanner(file)
-	var buffer bytes.Buffer
-	insideBead := false
-	commentRegex := regexp.MustCompile(`^\s*#`)
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		trimmedLine := strings.TrimSpace(line)
-
-		if strings.HasPrefix(trimmedLine, "bead ") && strings.HasSuffix(trimmedLine, "{") {
-			if insideBead {
-				buffer.WriteString("}\n")
-				formattedLines = append(formattedLines, buffer.String())
-				buffer.Reset()
-			}
-			insideBead = true
-			buffer.WriteString(trimmedLine + "\n")
-		} else if trimmedLine == "}" && insideBead {
-			buffer.WriteString(trimmedLine + "\n")
-			formattedLines = append(formattedLines, buffer.String())
-			buffer.Reset()
-			insideBead = false
-		} else if insideBead {
-			buffer.WriteString("  " + trimmedLine + "\n")
-		} else {
-			if commentRegex.MatchString(trimmedLine) {
-				
-				trimmedLine = strings.TrimSpace(trimmedLine)
-				trimmedLine = strings.Replace(trimmedLine, "#", "#", 1)
-			}
-			if trimmedLine != "" || (len(formattedLines) > 0 && formattedLines[len(formattedLines)-1] != "\n") {
-				formattedLines = append(formattedLines, trimmedLine+"\n")
-			}
-		}
-	}
 
-	if err := scanner.Err(); err != nil {
+	f, err := kd.Parse(filePath, src)
+	if err != nil {
 		return err
 	}
 
-	if insideBead {
-		buffer.WriteString("}\n")
-		formattedLines = append(formattedLines, buffer.String())
-	}
-
-	
-	if len(formattedLines) > 0 && formattedLines[len(formattedLines)-1] == "\n" {
-		formattedLines = formattedLines[:len(formattedLines)-1]
-	}
-
-	formattedContent := strings.Join(formattedLines, "")
-
-	err = os.WriteFile(filePath, []byte(formattedContent), 0644)
-	if err != nil {
-		return err
+	formatted := kd.Format(f)
+	if bytes.Equal(src, formatted) {
+		return nil
 	}
 
-	return nil
+	return os.WriteFile(filePath, formatted, 0644)
 }
 
-
 func FormatKDFilesInDir(dir string) error {
 	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -0,0 +1,40 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/janpreet/kado/packages/kd"
+)
+
+// LintKDFile reports syntax errors and style problems in a .kd file.
+func LintKDFile(filePath string) ([]kd.Diagnostic, error) {
+	src, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return kd.Lint(filePath, src), nil
+}
+
+func LintKDFilesInDir(dir string) ([]kd.Diagnostic, error) {
+	var diags []kd.Diagnostic
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && strings.HasSuffix(info.Name(), ".kd") {
+			fileDiags, err := LintKDFile(path)
+			if err != nil {
+				return fmt.Errorf("failed to lint %s: %v", path, err)
+			}
+			diags = append(diags, fileDiags...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return diags, nil
+}
@@ -0,0 +1,339 @@
+package helper
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/janpreet/kado/packages/bead"
+)
+
+// copyDir copies a directory source, or its subdirectory, into the bead's
+// directory.
+func copyDir(ctx *bead.Context, src Source, beadDir string) error {
+	from := filepath.Join(src.URL, src.Subdir)
+	if info, err := os.Stat(from); err != nil || !info.IsDir() {
+		return fmt.Errorf("source directory %s does not exist", from)
+	}
+	if err := prepareDir(beadDir); err != nil {
+		return err
+	}
+	err := filepath.WalkDir(from, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(from, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		to := filepath.Join(beadDir, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(to, info.Mode().Perm()|0700)
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, to)
+		default:
+			file, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			return writeFile(to, file, info.Mode().Perm())
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to copy %s: %v", from, err)
+	}
+	ctx.Log().Info("Directory copied", "from", from, "dir", beadDir)
+	return nil
+}
+
+// extractTarball downloads or opens a tarball source, which may be
+// compressed with gzip, and extracts it, or its subdirectory, into the
+// bead's directory.
+func extractTarball(ctx *bead.Context, src Source, beadDir string) error {
+	var body io.ReadCloser
+	var err error
+	if urlSchemeRegex.MatchString(src.URL) {
+		body, err = openURL(ctx, src.URL)
+	} else {
+		body, err = os.Open(src.URL)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open tarball: %v", err)
+	}
+	defer body.Close()
+
+	reader := bufio.NewReader(body)
+	var archive io.Reader = reader
+	if magic, err := reader.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return fmt.Errorf("failed to read tarball %s: %v", src.URL, err)
+		}
+		defer gz.Close()
+		archive = gz
+	}
+
+	if err := prepareDir(beadDir); err != nil {
+		return err
+	}
+	prefix := ""
+	if src.Subdir != "" {
+		prefix = filepath.ToSlash(src.Subdir) + "/"
+	}
+	found := prefix == ""
+	tr := tar.NewReader(archive)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tarball %s: %v", src.URL, err)
+		}
+		name := strings.TrimPrefix(filepath.ToSlash(filepath.Clean(header.Name)), "./")
+		if name == "." {
+			continue
+		}
+		if prefix != "" {
+			if name+"/" == prefix {
+				found = true
+				continue
+			}
+			if !strings.HasPrefix(name, prefix) {
+				continue
+			}
+			found = true
+			name = strings.TrimPrefix(name, prefix)
+		}
+		if name == ".." || strings.HasPrefix(name, "../") || strings.HasPrefix(name, "/") {
+			return fmt.Errorf("tarball %s has an entry outside its root: %s", src.URL, header.Name)
+		}
+		to := filepath.Join(beadDir, filepath.FromSlash(name))
+		if header.Typeflag == tar.TypeSymlink {
+			target := filepath.Join(filepath.Dir(to), filepath.FromSlash(header.Linkname))
+			if filepath.IsAbs(header.Linkname) || !insideDir(beadDir, target) {
+				return fmt.Errorf("tarball %s has a symlink outside its root: %s -> %s", src.URL, header.Name, header.Linkname)
+			}
+		}
+		if err := checkNoSymlink(beadDir, to); err != nil {
+			return fmt.Errorf("failed to extract %s: %v", header.Name, err)
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(to, os.FileMode(header.Mode).Perm()|0700)
+		case tar.TypeReg:
+			err = writeFile(to, tr, os.FileMode(header.Mode).Perm())
+		case tar.TypeSymlink:
+			if err = os.MkdirAll(filepath.Dir(to), 0755); err == nil {
+				err = os.Symlink(header.Linkname, to)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to extract %s: %v", header.Name, err)
+		}
+	}
+	if !found {
+		return fmt.Errorf("tarball %s has no directory %s", src.URL, src.Subdir)
+	}
+	ctx.Log().Info("Tarball extracted", "from", src.URL, "dir", beadDir)
+	return nil
+}
+
+// openURL starts downloading a file.
+func openURL(ctx *bead.Context, rawURL string) (io.ReadCloser, error) {
+	ctx.Log().Info("Downloading", "url", rawURL)
+	reqCtx := ctx.Context
+	if reqCtx == nil {
+		reqCtx = context.Background()
+	}
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %v", rawURL, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to download %s: %s", rawURL, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// download saves the file at rawURL to path.
+func download(ctx *bead.Context, rawURL, path string) error {
+	body, err := openURL(ctx, rawURL)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	if err := writeFile(path, body, 0644); err != nil {
+		return fmt.Errorf("failed to download %s: %v", rawURL, err)
+	}
+	return nil
+}
+
+// prepareDir empties the bead's directory for a copied or extracted
+// source, keeping the preservedFiles.
+func prepareDir(beadDir string) error {
+	if err := removeLink(beadDir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(beadDir, os.ModePerm); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(beadDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if isPreserved(entry.Name()) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(beadDir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isPreserved(name string) bool {
+	for _, preserved := range preservedFiles {
+		if matched, _ := filepath.Match(preserved, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// insideDir reports whether path is dir or lies below it.
+func insideDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// checkNoSymlink fails when path, or a directory between dir and path, is a
+// symlink, so an extracted entry is never written through a link.
+func checkNoSymlink(dir, path string) error {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return err
+	}
+	current := dir
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		current = filepath.Join(current, part)
+		info, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("refusing to write through the symlink %s", current)
+		}
+	}
+	return nil
+}
+
+func writeFile(path string, r io.Reader, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// WriteArchive packs the directory dir into a gzip-compressed tarball at
+// path, with entries relative to the parent of dir.
+func WriteArchive(dir, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create archive: %v", err)
+	}
+	gz := gzip.NewWriter(file)
+	tw := tar.NewWriter(gz)
+	base := filepath.Dir(filepath.Clean(dir))
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(base, p)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		if d.IsDir() {
+			header.Name += "/"
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err == nil {
+		err = tw.Close()
+	}
+	if err == nil {
+		err = gz.Close()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write archive %s: %v", path, err)
+	}
+	return nil
+}
@@ -1,40 +1,270 @@
 package helper
 
 import (
-	"log"
+	"bytes"
+	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/janpreet/kado/packages/bead"
+	"github.com/janpreet/kado/packages/config"
 )
 
-func CloneRepo(source, destination, beadName, refs string) error {
+// SourcesDir is the directory in the LandingZone that holds the clones of
+// sources with a //subdir. The bead's directory links to the subdirectory.
+const SourcesDir = ".sources"
+
+// preservedFiles are left in place when an existing clone is cleaned, so
+// terraform and terragrunt do not download providers and modules again and a
+// local state, including the state of workspaces, survives the next run.
+// They are patterns, as matched by filepath.Match and git clean -e.
+var preservedFiles = []string{".terraform", ".terraform.lock.hcl", ".terragrunt-cache", "terraform.tfstate*", "terraform.tfstate.d"}
+
+// commitRegex matches refs that name a commit rather than a branch or tag.
+var commitRegex = regexp.MustCompile(`^[0-9a-fA-F]{7,40}$`)
+
+// CloneRepo fetches the source of a bead into its directory in destination,
+// see ParseSource for the addresses it accepts, and returns the commit a git
+// source resolved to. refs, if set, takes precedence over the ref of the
+// address. A git source already cloned by an earlier run is fetched and
+// reset to refs, or to the remote's default branch, instead of cloned again;
+// untracked files but the preservedFiles are removed.
+func CloneRepo(ctx *bead.Context, source, destination, beadName, refs string) (string, error) {
+	source, err := VendoredSource(source)
+	if err != nil {
+		return "", err
+	}
+	src, err := ParseSource(source)
+	if err != nil {
+		return "", err
+	}
+	if refs == "" {
+		refs = src.Ref
+	}
 
 	beadDir := filepath.Join(destination, beadName)
-	if !FileExists(beadDir) {
-		err := os.MkdirAll(beadDir, os.ModePerm)
-		if err != nil {
-			return err
+	switch src.Kind {
+	case SourceDir:
+		return "", copyDir(ctx, src, beadDir)
+	case SourceTar:
+		return "", extractTarball(ctx, src, beadDir)
+	}
+
+	if src.Subdir == "" {
+		if err := removeLink(beadDir); err != nil {
+			return "", err
 		}
+		return fetchRepo(ctx, src, beadDir, refs)
 	}
 
-	cmd := exec.Command("git", "clone", source, beadDir)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	err := cmd.Run()
+	checkoutDir := filepath.Join(destination, SourcesDir, beadName)
+	commit, err := fetchRepo(ctx, src, checkoutDir, refs)
+	if err != nil {
+		return "", err
+	}
+	subdir := filepath.Join(checkoutDir, src.Subdir)
+	if info, err := os.Stat(subdir); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("source %s has no directory %s", source, src.Subdir)
+	}
+	target, err := filepath.Abs(subdir)
 	if err != nil {
-		return err
+		return "", err
+	}
+	if current, err := os.Readlink(beadDir); err != nil || current != target {
+		if err := os.RemoveAll(beadDir); err != nil {
+			return "", err
+		}
+		if err := os.Symlink(target, beadDir); err != nil {
+			return "", fmt.Errorf("failed to link %s to %s: %v", beadDir, subdir, err)
+		}
+	}
+	return commit, nil
+}
+
+// removeLink removes dir if it is a symbolic link, left by an earlier run
+// whose source had a //subdir.
+func removeLink(dir string) error {
+	if info, err := os.Lstat(dir); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return os.Remove(dir)
+	}
+	return nil
+}
+
+func fetchRepo(ctx *bead.Context, src Source, dir, refs string) (string, error) {
+	git := func(args ...string) *exec.Cmd {
+		return gitCommand(ctx, src, append([]string{"-C", dir}, args...)...)
+	}
+
+	cloned := !FileExists(filepath.Join(dir, ".git"))
+	if cloned {
+		if FileExists(dir) {
+			ctx.Log().Info("Removing directory that is not a clone", "dir", dir)
+			if err := os.RemoveAll(dir); err != nil {
+				return "", err
+			}
+		}
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return "", err
+		}
+		if err := git("init", "-q").Run(); err != nil {
+			return "", err
+		}
+		if err := git("remote", "add", "origin", src.URL).Run(); err != nil {
+			return "", err
+		}
+	} else if err := git("remote", "set-url", "origin", src.URL).Run(); err != nil {
+		return "", err
 	}
 
+	var target string
+	if src.Depth > 0 {
+		// A shallow fetch only brings the one ref, which may be a branch,
+		// a tag or a full commit SHA.
+		ref := refs
+		if ref == "" {
+			ref = "HEAD"
+		}
+		if err := git("fetch", "--force", "--no-tags", "--depth", strconv.Itoa(src.Depth), "origin", ref).Run(); err != nil {
+			return "", err
+		}
+		target = "FETCH_HEAD"
+	} else {
+		if err := git("fetch", "--prune", "--tags", "--force", "origin").Run(); err != nil {
+			return "", err
+		}
+		target = "origin/HEAD"
+		if refs != "" {
+			// A branch is reset to its fetched remote head; tags and
+			// commits are checked out as they are.
+			target = refs
+			if revParse(ctx, dir, "refs/remotes/origin/"+refs) != "" {
+				target = "origin/" + refs
+			}
+		} else if revParse(ctx, dir, target) == "" {
+			if err := git("remote", "set-head", "origin", "--auto").Run(); err != nil {
+				return "", err
+			}
+		}
+		if revParse(ctx, dir, target) == "" {
+			return "", fmt.Errorf("ref %q not found in %s", refs, src.URL)
+		}
+	}
+
+	if err := git("checkout", "--force", "--detach", target).Run(); err != nil {
+		return "", err
+	}
+	if FileExists(filepath.Join(dir, ".gitmodules")) {
+		if err := git("submodule", "update", "--init", "--recursive", "--force").Run(); err != nil {
+			return "", err
+		}
+	}
+	cleanArgs := []string{"clean", "-ffdx"}
+	for _, name := range preservedFiles {
+		cleanArgs = append(cleanArgs, "-e", name)
+	}
+	if err := git(cleanArgs...).Run(); err != nil {
+		return "", err
+	}
+
+	commit := revParse(ctx, dir, "HEAD")
+	if commitRegex.MatchString(refs) && !strings.HasPrefix(commit, strings.ToLower(refs)) {
+		return "", fmt.Errorf("ref %s resolved to commit %s in %s, not to the commit it names", refs, commit, src.URL)
+	}
+	if cloned {
+		ctx.Log().Info("Repository cloned", "dir", dir, "commit", commit)
+	} else {
+		ctx.Log().Info("Repository updated", "dir", dir, "commit", commit)
+	}
+	return commit, nil
+}
+
+// ResolveCommit returns the commit the refs of a git source, or the ref of
+// its address, currently names on the remote, without cloning it. A ref is
+// looked up as a branch and then as a tag; a full commit SHA that names
+// neither is returned as it is. It returns an empty string for sources that
+// are not git repositories.
+func ResolveCommit(ctx *bead.Context, source, refs string) (string, error) {
+	source, err := VendoredSource(source)
+	if err != nil {
+		return "", err
+	}
+	src, err := ParseSource(source)
+	if err != nil {
+		return "", err
+	}
+	if src.Kind != SourceGit {
+		return "", nil
+	}
+	if refs == "" {
+		refs = src.Ref
+	}
+	// The second pattern lists the commits annotated tags point to.
+	patterns := []string{"HEAD"}
 	if refs != "" {
-		cmd = exec.Command("git", "-C", beadDir, "checkout", refs)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		err = cmd.Run()
-		if err != nil {
-			return err
+		patterns = []string{refs, refs + "^{}"}
+	}
+
+	cmd := gitCommand(ctx, src, append([]string{"ls-remote", src.URL}, patterns...)...)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("failed to list the refs of %s: %v", src.URL, err)
+	}
+	remoteRefs := make(map[string]string)
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 {
+			remoteRefs[fields[1]] = fields[0]
 		}
 	}
 
-	log.Printf("Repository for %s cloned to: %s", beadName, beadDir)
-	return nil
+	candidates := []string{"HEAD"}
+	if refs != "" {
+		candidates = []string{"refs/heads/" + refs, "refs/tags/" + refs + "^{}", "refs/tags/" + refs}
+	}
+	for _, name := range candidates {
+		if commit, ok := remoteRefs[name]; ok {
+			return commit, nil
+		}
+	}
+	if len(refs) == 40 && commitRegex.MatchString(refs) {
+		return strings.ToLower(refs), nil
+	}
+	if commitRegex.MatchString(refs) {
+		return "", fmt.Errorf("ref %s of %s looks like an abbreviated commit; use the full commit SHA", refs, src.URL)
+	}
+	return "", fmt.Errorf("ref %q not found in %s", refs, src.URL)
+}
+
+// gitCommand returns a git command that uses the ssh key of src, if set. In
+// offline runs git may only use local repositories.
+func gitCommand(ctx *bead.Context, src Source, args ...string) *exec.Cmd {
+	cmd := ctx.Command("", "git", args...)
+	var env []string
+	if src.SSHKey != "" {
+		env = append(env, "GIT_SSH_COMMAND=ssh -i '"+strings.ReplaceAll(src.SSHKey, "'", `'\''`)+"' -o IdentitiesOnly=yes")
+	}
+	if config.Offline {
+		env = append(env, "GIT_ALLOW_PROTOCOL=file")
+	}
+	if env != nil {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	return cmd
+}
+
+// revParse returns the commit rev names in the repository at dir, or an
+// empty string if it names none.
+func revParse(ctx *bead.Context, dir, rev string) string {
+	cmd := ctx.Command("", "git", "-C", dir, "rev-parse", "--verify", "--quiet", rev+"^{commit}")
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = nil
+	if cmd.Run() != nil {
+		return ""
+	}
+	return strings.TrimSpace(stdout.String())
 }
@@ -0,0 +1,292 @@
+package helper
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/janpreet/kado/packages/bead"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func git(t *testing.T, dir string, args ...string) string {
+	args = append([]string{"-C", dir, "-c", "user.name=kado", "-c", "user.email=kado@example.com", "-c", "protocol.file.allow=always"}, args...)
+	out, err := exec.Command("git", args...).CombinedOutput()
+	require.NoError(t, err, string(out))
+	return strings.TrimSpace(string(out))
+}
+
+// sourceRepo creates a git repository with main.tf in its root and in
+// modules/vpc, committed as v1.
+func sourceRepo(t *testing.T) string {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	source := t.TempDir()
+	git(t, source, "init", "-q", "-b", "main")
+	require.NoError(t, os.MkdirAll(filepath.Join(source, "modules", "vpc"), 0755))
+	writeMainTF(t, source, "v1")
+	git(t, source, "add", "-A")
+	git(t, source, "commit", "-q", "-m", "v1")
+	return source
+}
+
+func writeMainTF(t *testing.T, dir, version string) {
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.tf"), []byte("# "+version+"\n"), 0644))
+	if FileExists(filepath.Join(dir, "modules")) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "modules", "vpc", "main.tf"), []byte("# vpc "+version+"\n"), 0644))
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return string(content)
+}
+
+func testContext() *bead.Context {
+	return &bead.Context{Stdout: io.Discard, Stderr: io.Discard}
+}
+
+func TestCloneRepoUpdatesExistingClone(t *testing.T) {
+	source := sourceRepo(t)
+	landingZone := t.TempDir()
+	ctx := testContext()
+	beadDir := filepath.Join(landingZone, "network")
+
+	commit, err := CloneRepo(ctx, source, landingZone, "network", "")
+	require.NoError(t, err)
+	assert.Equal(t, git(t, source, "rev-parse", "HEAD"), commit)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(beadDir, ".terraform", "providers"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(beadDir, "stale.tfvars"), []byte("x = 1\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(beadDir, "main.tf"), []byte("# edited\n"), 0644))
+	writeMainTF(t, source, "v2")
+	git(t, source, "commit", "-q", "-am", "v2")
+
+	_, err = CloneRepo(ctx, source, landingZone, "network", "")
+	require.NoError(t, err)
+	assert.Equal(t, "# v2\n", readFile(t, filepath.Join(beadDir, "main.tf")))
+	assert.DirExists(t, filepath.Join(beadDir, ".terraform", "providers"))
+	assert.NoFileExists(t, filepath.Join(beadDir, "stale.tfvars"))
+
+	git(t, source, "tag", "v2")
+	writeMainTF(t, source, "v3")
+	git(t, source, "commit", "-q", "-am", "v3")
+	_, err = CloneRepo(ctx, source, landingZone, "network", "v2")
+	require.NoError(t, err)
+	assert.Equal(t, "# v2\n", readFile(t, filepath.Join(beadDir, "main.tf")))
+
+	_, err = CloneRepo(ctx, source+"?ref=main", landingZone, "network", "")
+	require.NoError(t, err)
+	assert.Equal(t, "# v3\n", readFile(t, filepath.Join(beadDir, "main.tf")))
+}
+
+func TestCloneRepoKeepsState(t *testing.T) {
+	state := []string{"terraform.tfstate", "terraform.tfstate.backup", filepath.Join("terraform.tfstate.d", "staging", "terraform.tfstate")}
+	source := sourceRepo(t)
+	directory := t.TempDir()
+	writeMainTF(t, directory, "v1")
+
+	for name, src := range map[string]string{"git": source, "directory": directory} {
+		t.Run(name, func(t *testing.T) {
+			landingZone := t.TempDir()
+			beadDir := filepath.Join(landingZone, "network")
+			_, err := CloneRepo(testContext(), src, landingZone, "network", "")
+			require.NoError(t, err)
+			for _, name := range state {
+				require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(beadDir, name)), 0755))
+				require.NoError(t, os.WriteFile(filepath.Join(beadDir, name), []byte("{}\n"), 0644))
+			}
+
+			_, err = CloneRepo(testContext(), src, landingZone, "network", "")
+			require.NoError(t, err)
+			for _, name := range state {
+				assert.Equal(t, "{}\n", readFile(t, filepath.Join(beadDir, name)))
+			}
+		})
+	}
+}
+
+func TestCloneRepoPinnedCommit(t *testing.T) {
+	source := sourceRepo(t)
+	v1 := git(t, source, "rev-parse", "HEAD")
+	writeMainTF(t, source, "v2")
+	git(t, source, "commit", "-q", "-am", "v2")
+	landingZone := t.TempDir()
+
+	commit, err := CloneRepo(testContext(), source, landingZone, "network", v1[:10])
+	require.NoError(t, err)
+	assert.Equal(t, v1, commit)
+	assert.Equal(t, "# v1\n", readFile(t, filepath.Join(landingZone, "network", "main.tf")))
+
+	// A branch named like a commit shadows it.
+	git(t, source, "branch", "abcdef1")
+	_, err = CloneRepo(testContext(), source, landingZone, "network", "abcdef1")
+	assert.ErrorContains(t, err, "not to the commit it names")
+
+	_, err = CloneRepo(testContext(), source, landingZone, "network", "missing")
+	assert.ErrorContains(t, err, `ref "missing" not found`)
+}
+
+func TestCloneRepoShallowSubdir(t *testing.T) {
+	source := sourceRepo(t)
+	writeMainTF(t, source, "v2")
+	git(t, source, "commit", "-q", "-am", "v2")
+	landingZone := t.TempDir()
+
+	address := "git::file://" + filepath.ToSlash(source) + "//modules/vpc?depth=1"
+	commit, err := CloneRepo(testContext(), address, landingZone, "vpc", "main")
+	require.NoError(t, err)
+	assert.Equal(t, git(t, source, "rev-parse", "HEAD"), commit)
+
+	beadDir := filepath.Join(landingZone, "vpc")
+	assert.Equal(t, "# vpc v2\n", readFile(t, filepath.Join(beadDir, "main.tf")))
+	assert.Equal(t, "1", git(t, filepath.Join(landingZone, SourcesDir, "vpc"), "rev-list", "--count", "HEAD"))
+
+	// Without the subdirectory the bead's directory is a clone again.
+	_, err = CloneRepo(testContext(), source, landingZone, "vpc", "")
+	require.NoError(t, err)
+	assert.Equal(t, "# v2\n", readFile(t, filepath.Join(beadDir, "main.tf")))
+}
+
+func TestCloneRepoDirectory(t *testing.T) {
+	source := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(source, "site", "roles"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(source, "site", "playbook.yaml"), []byte("- hosts: all\n"), 0644))
+	landingZone := t.TempDir()
+	beadDir := filepath.Join(landingZone, "configure")
+	require.NoError(t, os.MkdirAll(filepath.Join(beadDir, ".terraform"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(beadDir, "old.yaml"), nil, 0644))
+
+	commit, err := CloneRepo(testContext(), source+"//site", landingZone, "configure", "")
+	require.NoError(t, err)
+	assert.Empty(t, commit)
+	assert.Equal(t, "- hosts: all\n", readFile(t, filepath.Join(beadDir, "playbook.yaml")))
+	assert.DirExists(t, filepath.Join(beadDir, "roles"))
+	assert.DirExists(t, filepath.Join(beadDir, ".terraform"))
+	assert.NoFileExists(t, filepath.Join(beadDir, "old.yaml"))
+}
+
+func TestCloneRepoTarball(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "infra.tar.gz")
+	file, err := os.Create(archive)
+	require.NoError(t, err)
+	gz := gzip.NewWriter(file)
+	tw := tar.NewWriter(gz)
+	for name, content := range map[string]string{"infra-1.2/README.md": "infra\n", "infra-1.2/network/main.tf": "# network\n"} {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	require.NoError(t, file.Close())
+	landingZone := t.TempDir()
+
+	_, err = CloneRepo(testContext(), archive+"//infra-1.2/network", landingZone, "network", "")
+	require.NoError(t, err)
+	assert.Equal(t, "# network\n", readFile(t, filepath.Join(landingZone, "network", "main.tf")))
+	assert.NoFileExists(t, filepath.Join(landingZone, "network", "README.md"))
+
+	_, err = CloneRepo(testContext(), archive+"//compute", landingZone, "network", "")
+	assert.ErrorContains(t, err, "has no directory compute")
+}
+
+// writeTarball writes a gzip-compressed tarball of the given entries, regular
+// files by content and symlinks, whose content starts with "->", by target.
+func writeTarball(t *testing.T, entries [][2]string) string {
+	archive := filepath.Join(t.TempDir(), "infra.tar.gz")
+	file, err := os.Create(archive)
+	require.NoError(t, err)
+	gz := gzip.NewWriter(file)
+	tw := tar.NewWriter(gz)
+	for _, entry := range entries {
+		name, content := entry[0], entry[1]
+		if target, ok := strings.CutPrefix(content, "->"); ok {
+			require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Linkname: target, Mode: 0777, Typeflag: tar.TypeSymlink}))
+			continue
+		}
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	require.NoError(t, file.Close())
+	return archive
+}
+
+func TestCloneRepoTarballSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need privileges on windows")
+	}
+	outside := t.TempDir()
+	landingZone := t.TempDir()
+	beadDir := filepath.Join(landingZone, "network")
+
+	archive := writeTarball(t, [][2]string{{"modules/vm.tf", "# vm\n"}, {"main.tf", "->modules/vm.tf"}})
+	_, err := CloneRepo(testContext(), archive, landingZone, "network", "")
+	require.NoError(t, err)
+	assert.Equal(t, "# vm\n", readFile(t, filepath.Join(beadDir, "main.tf")))
+
+	for name, entries := range map[string][][2]string{
+		"absolute": {{"esc", "->" + outside}, {"esc/owned.txt", "owned\n"}},
+		"relative": {{"modules/esc", "->../../.."}, {"modules/esc/owned.txt", "owned\n"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := CloneRepo(testContext(), writeTarball(t, entries), landingZone, "network", "")
+			assert.ErrorContains(t, err, "has a symlink outside its root")
+			assert.NoFileExists(t, filepath.Join(outside, "owned.txt"))
+			assert.NoFileExists(t, filepath.Join(landingZone, "owned.txt"))
+		})
+	}
+
+	archive = writeTarball(t, [][2]string{{"modules/vm.tf", "# vm\n"}, {"link", "->modules"}, {"link/vm.tf", "# owned\n"}})
+	_, err = CloneRepo(testContext(), archive, landingZone, "network", "")
+	assert.ErrorContains(t, err, "refusing to write through the symlink")
+	assert.Equal(t, "# vm\n", readFile(t, filepath.Join(beadDir, "modules", "vm.tf")))
+}
+
+func TestResolveCommit(t *testing.T) {
+	source := sourceRepo(t)
+	v1 := git(t, source, "rev-parse", "HEAD")
+	git(t, source, "tag", "-a", "-m", "release", "v1")
+	writeMainTF(t, source, "v2")
+	git(t, source, "commit", "-q", "-am", "v2")
+	v2 := git(t, source, "rev-parse", "HEAD")
+	ctx := testContext()
+
+	commit, err := ResolveCommit(ctx, source, "")
+	require.NoError(t, err)
+	assert.Equal(t, v2, commit)
+
+	commit, err = ResolveCommit(ctx, source, "v1")
+	require.NoError(t, err)
+	assert.Equal(t, v1, commit)
+
+	commit, err = ResolveCommit(ctx, "git::file://"+filepath.ToSlash(source)+"?ref=main", "")
+	require.NoError(t, err)
+	assert.Equal(t, v2, commit)
+
+	commit, err = ResolveCommit(ctx, source, strings.ToUpper(v1))
+	require.NoError(t, err)
+	assert.Equal(t, v1, commit)
+
+	_, err = ResolveCommit(ctx, source, v1[:8])
+	assert.ErrorContains(t, err, "use the full commit SHA")
+
+	_, err = ResolveCommit(ctx, source, "missing")
+	assert.ErrorContains(t, err, `ref "missing" not found`)
+
+	commit, err = ResolveCommit(ctx, t.TempDir(), "")
+	require.NoError(t, err)
+	assert.Empty(t, commit)
+}
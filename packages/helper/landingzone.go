@@ -0,0 +1,114 @@
+package helper
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/janpreet/kado/packages/config"
+)
+
+// LockFile is the file in the LandingZone a run holds a lock on, so that two
+// runs never work in the same LandingZone at once.
+const LockFile = ".kado-run.lock"
+
+// PluginCacheDir is the directory in the LandingZone terraform caches
+// providers in, unless TF_PLUGIN_CACHE_DIR is already set.
+const PluginCacheDir = ".plugin-cache"
+
+// LandingZoneLock is held by a run for as long as it works in the
+// LandingZone.
+type LandingZoneLock struct {
+	file *os.File
+}
+
+// SetupLandingZone creates the LandingZone if needed and locks it against
+// other runs. The bead directories of earlier runs are kept, so repositories
+// are fetched instead of cloned again and terraform keeps its .terraform
+// directories; with clean everything in it is removed first. The returned
+// lock must be released when the run ends.
+func SetupLandingZone(clean bool) (*LandingZoneLock, error) {
+	landingZone := config.LandingZone
+	if err := os.MkdirAll(landingZone, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create landing zone: %v", err)
+	}
+
+	lock, err := lockLandingZone(landingZone)
+	if err != nil {
+		return nil, err
+	}
+
+	if clean {
+		if err := cleanLandingZone(landingZone); err != nil {
+			lock.Release()
+			return nil, err
+		}
+	}
+
+	if os.Getenv("TF_PLUGIN_CACHE_DIR") == "" {
+		cacheDir, err := filepath.Abs(filepath.Join(landingZone, PluginCacheDir))
+		if err == nil {
+			err = os.MkdirAll(cacheDir, 0755)
+		}
+		if err != nil {
+			lock.Release()
+			return nil, fmt.Errorf("failed to create provider cache: %v", err)
+		}
+		os.Setenv("TF_PLUGIN_CACHE_DIR", cacheDir)
+	}
+	return lock, nil
+}
+
+func lockLandingZone(landingZone string) (*LandingZoneLock, error) {
+	path := filepath.Join(landingZone, LockFile)
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %v", err)
+	}
+	if err := lockFile(file); err != nil {
+		content, _ := os.ReadFile(path)
+		file.Close()
+		if err == errLocked {
+			owner := strings.TrimSpace(string(content))
+			if owner == "" {
+				owner = "unknown"
+			}
+			return nil, fmt.Errorf("landing zone %s is in use by another kado run (pid %s)", landingZone, owner)
+		}
+		return nil, fmt.Errorf("failed to lock landing zone: %v", err)
+	}
+	if err := file.Truncate(0); err == nil {
+		file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	return &LandingZoneLock{file: file}, nil
+}
+
+// Release unlocks the LandingZone for other runs.
+func (l *LandingZoneLock) Release() {
+	if l == nil || l.file == nil {
+		return
+	}
+	l.file.Truncate(0)
+	unlockFile(l.file)
+	l.file.Close()
+	l.file = nil
+}
+
+// cleanLandingZone removes everything in the LandingZone but the lock file.
+func cleanLandingZone(landingZone string) error {
+	entries, err := os.ReadDir(landingZone)
+	if err != nil {
+		return fmt.Errorf("failed to clean landing zone: %v", err)
+	}
+	for _, entry := range entries {
+		if entry.Name() == LockFile {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(landingZone, entry.Name())); err != nil {
+			return fmt.Errorf("failed to clean landing zone: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package helper
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/janpreet/kado/packages/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func useLandingZone(t *testing.T) string {
+	previous := config.LandingZone
+	config.LandingZone = t.TempDir()
+	t.Cleanup(func() { config.LandingZone = previous })
+	t.Setenv("TF_PLUGIN_CACHE_DIR", "")
+	return config.LandingZone
+}
+
+func TestSetupLandingZoneLocks(t *testing.T) {
+	landingZone := useLandingZone(t)
+
+	lock, err := SetupLandingZone(false)
+	require.NoError(t, err)
+
+	_, err = SetupLandingZone(false)
+	assert.ErrorContains(t, err, "is in use by another kado run")
+
+	lock.Release()
+	lock, err = SetupLandingZone(false)
+	require.NoError(t, err)
+	defer lock.Release()
+	assert.Equal(t, filepath.Join(landingZone, PluginCacheDir), os.Getenv("TF_PLUGIN_CACHE_DIR"))
+}
+
+func TestSetupLandingZoneClean(t *testing.T) {
+	landingZone := useLandingZone(t)
+	beadDir := filepath.Join(landingZone, "network")
+	require.NoError(t, os.MkdirAll(beadDir, 0755))
+
+	lock, err := SetupLandingZone(false)
+	require.NoError(t, err)
+	lock.Release()
+	assert.DirExists(t, beadDir)
+
+	lock, err = SetupLandingZone(true)
+	require.NoError(t, err)
+	defer lock.Release()
+	assert.NoDirExists(t, beadDir)
+	assert.FileExists(t, filepath.Join(landingZone, LockFile))
+}
@@ -0,0 +1,182 @@
+package helper
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Kinds of bead sources.
+const (
+	SourceGit = "git"
+	SourceDir = "dir"
+	SourceTar = "tar"
+)
+
+// Source is a parsed bead source address. Addresses follow go-getter:
+//
+//	git::https://github.com/org/infra.git//modules/vpc?ref=v1.2&depth=1
+//
+// An optional forced kind (git::, file:: or tar::) is followed by the
+// location, an optional //subdir and optional ref, depth and sshkey
+// parameters. Without a forced kind, archives ending in .tar, .tar.gz or
+// .tgz are tarballs, URLs and scp-like addresses are git repositories and
+// local paths are git repositories if they contain .git and directories
+// otherwise.
+type Source struct {
+	Kind string
+	// URL is the repository URL, or the path or URL of the directory or
+	// tarball. Local paths are absolute.
+	URL string
+	// Subdir is the directory of the source the bead uses, if not its root.
+	Subdir string
+	// Ref is the branch, tag or commit to check out; the refs field of the
+	// bead takes precedence.
+	Ref string
+	// Depth makes a shallow clone of that many commits when positive.
+	Depth int
+	// SSHKey is the path of the private key git uses over ssh.
+	SSHKey string
+}
+
+var (
+	forcedKindRegex = regexp.MustCompile(`^([a-z0-9]+)::`)
+	scpLikeRegex    = regexp.MustCompile(`^[\w.-]+@[\w.-]+:`)
+	urlSchemeRegex  = regexp.MustCompile(`^[a-z][a-z0-9+.-]*://`)
+)
+
+// ParseSource parses a source address.
+func ParseSource(address string) (Source, error) {
+	var src Source
+	rest := strings.TrimSpace(address)
+	if rest == "" {
+		return src, fmt.Errorf("source is empty")
+	}
+	if m := forcedKindRegex.FindStringSubmatch(rest); m != nil {
+		switch m[1] {
+		case "git":
+			src.Kind = SourceGit
+		case "file":
+			src.Kind = SourceDir
+		case "tar":
+			src.Kind = SourceTar
+		default:
+			return src, fmt.Errorf("unknown source kind %q in %s, expected git::, file:: or tar::", m[1], address)
+		}
+		rest = rest[len(m[0]):]
+	}
+
+	urlQuery := url.Values{}
+	if i := strings.Index(rest, "?"); i >= 0 {
+		query, err := url.ParseQuery(rest[i+1:])
+		if err != nil {
+			return src, fmt.Errorf("failed to parse parameters of source %s: %v", address, err)
+		}
+		rest = rest[:i]
+		for key, values := range query {
+			value := values[len(values)-1]
+			switch key {
+			case "ref":
+				src.Ref = value
+			case "depth":
+				depth, err := strconv.Atoi(value)
+				if err != nil || depth < 1 {
+					return src, fmt.Errorf("depth must be a positive number in source %s, got %q", address, value)
+				}
+				src.Depth = depth
+			case "sshkey":
+				src.SSHKey = expandHome(value)
+			default:
+				if !urlSchemeRegex.MatchString(rest) {
+					return src, fmt.Errorf("unknown parameter %q in source %s", key, address)
+				}
+				// Other parameters belong to the URL, e.g. a signed
+				// download link.
+				urlQuery[key] = values
+			}
+		}
+	}
+
+	rest, src.Subdir = splitSubdir(rest)
+	if src.Subdir != "" {
+		subdir := filepath.Clean(filepath.FromSlash(src.Subdir))
+		if filepath.IsAbs(subdir) || subdir == "." || subdir == ".." || strings.HasPrefix(subdir, ".."+string(filepath.Separator)) {
+			return src, fmt.Errorf("subdirectory %q of source %s must be a relative path inside it", src.Subdir, address)
+		}
+		src.Subdir = subdir
+	}
+	if rest == "" {
+		return src, fmt.Errorf("source %s has no location", address)
+	}
+	if len(urlQuery) > 0 {
+		rest += "?" + urlQuery.Encode()
+	}
+
+	isURL := urlSchemeRegex.MatchString(rest) || scpLikeRegex.MatchString(rest)
+	if src.Kind == "" {
+		switch {
+		case isTarball(rest):
+			src.Kind = SourceTar
+		case isURL:
+			src.Kind = SourceGit
+		case FileExists(filepath.Join(expandHome(rest), ".git")):
+			src.Kind = SourceGit
+		default:
+			src.Kind = SourceDir
+		}
+	}
+	if !isURL {
+		path, err := filepath.Abs(expandHome(rest))
+		if err != nil {
+			return src, fmt.Errorf("failed to resolve source %s: %v", address, err)
+		}
+		rest = path
+	}
+	src.URL = rest
+
+	if src.Kind != SourceGit && (src.Ref != "" || src.Depth != 0 || src.SSHKey != "") {
+		return src, fmt.Errorf("ref, depth and sshkey only apply to git sources, not to %s", address)
+	}
+	if src.Kind == SourceDir && isURL {
+		return src, fmt.Errorf("directory source %s must be a local path", address)
+	}
+	return src, nil
+}
+
+// splitSubdir splits a //subdir off the end of a location, ignoring the
+// // of a URL scheme.
+func splitSubdir(location string) (string, string) {
+	offset := 0
+	if i := strings.Index(location, "://"); i >= 0 {
+		offset = i + 3
+	}
+	i := strings.Index(location[offset:], "//")
+	if i < 0 {
+		return location, ""
+	}
+	i += offset
+	return location[:i], location[i+2:]
+}
+
+func isTarball(location string) bool {
+	location = strings.SplitN(location, "?", 2)[0]
+	for _, ext := range []string{".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(location, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[1:])
+		}
+	}
+	return path
+}
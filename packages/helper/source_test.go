@@ -0,0 +1,47 @@
+package helper
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSource(t *testing.T) {
+	src, err := ParseSource("git::https://github.com/org/infra.git//modules/vpc?ref=v1.2&depth=1&sshkey=/keys/deploy")
+	require.NoError(t, err)
+	assert.Equal(t, Source{Kind: SourceGit, URL: "https://github.com/org/infra.git", Subdir: filepath.FromSlash("modules/vpc"), Ref: "v1.2", Depth: 1, SSHKey: "/keys/deploy"}, src)
+
+	src, err = ParseSource("git@github.com:org/infra.git?ref=main")
+	require.NoError(t, err)
+	assert.Equal(t, Source{Kind: SourceGit, URL: "git@github.com:org/infra.git", Ref: "main"}, src)
+
+	src, err = ParseSource("https://example.com/infra-1.2.tar.gz//network?token=abc")
+	require.NoError(t, err)
+	assert.Equal(t, Source{Kind: SourceTar, URL: "https://example.com/infra-1.2.tar.gz?token=abc", Subdir: "network"}, src)
+
+	dir := t.TempDir()
+	src, err = ParseSource(dir)
+	require.NoError(t, err)
+	assert.Equal(t, Source{Kind: SourceDir, URL: dir}, src)
+
+	require.NoError(t, os.Mkdir(filepath.Join(dir, ".git"), 0755))
+	src, err = ParseSource(dir + "?ref=main")
+	require.NoError(t, err)
+	assert.Equal(t, Source{Kind: SourceGit, URL: dir, Ref: "main"}, src)
+
+	for address, msg := range map[string]string{
+		"":                 "source is empty",
+		"s3::bucket/infra": `unknown source kind "s3"`,
+		"https://github.com/org/infra.git?depth=0": "depth must be a positive number",
+		"./infra?branch=main":                      `unknown parameter "branch"`,
+		"https://github.com/org/infra.git//../x":   "must be a relative path inside it",
+		"file::./infra?ref=main":                   "only apply to git sources",
+		"file::https://example.com/infra":          "must be a local path",
+	} {
+		_, err := ParseSource(address)
+		assert.ErrorContains(t, err, msg, address)
+	}
+}
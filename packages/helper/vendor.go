@@ -0,0 +1,127 @@
+package helper
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/janpreet/kado/packages/bead"
+	"github.com/janpreet/kado/packages/config"
+)
+
+var vendorNameRegex = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// vendorPath returns where a source is stored in config.VendorDir: a mirror
+// clone for git repositories and the archive for tarballs. Local
+// directories and tarballs are not vendored, so ok is false for them.
+func vendorPath(src Source) (path string, ok bool) {
+	remote := urlSchemeRegex.MatchString(src.URL) || scpLikeRegex.MatchString(src.URL)
+	if src.Kind == SourceDir || (src.Kind == SourceTar && !remote) {
+		return "", false
+	}
+	location := strings.SplitN(src.URL, "?", 2)[0]
+	location = urlSchemeRegex.ReplaceAllString(location, "")
+	name := strings.Trim(vendorNameRegex.ReplaceAllString(strings.TrimSuffix(location, ".git"), "_"), "_.")
+	if len(name) > 60 {
+		name = name[len(name)-60:]
+	}
+	sum := sha256.Sum256([]byte(src.Kind + "::" + src.URL))
+	name += "-" + hex.EncodeToString(sum[:4])
+	if src.Kind == SourceGit {
+		name += ".git"
+	} else {
+		name += ".tar"
+	}
+	return filepath.Join(config.VendorDir, name), true
+}
+
+// VendorSource stores a bead's source in config.VendorDir for offline runs
+// and returns where. A git repository is kept as a mirror clone with all its
+// branches and tags, updated if it is already there; a remote tarball is
+// downloaded. Local directories and tarballs are left where they are and
+// an empty path is returned.
+func VendorSource(ctx *bead.Context, source string) (string, error) {
+	src, err := ParseSource(source)
+	if err != nil {
+		return "", err
+	}
+	path, ok := vendorPath(src)
+	if !ok {
+		return "", nil
+	}
+	if err := os.MkdirAll(config.VendorDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create vendor directory: %v", err)
+	}
+
+	if src.Kind == SourceTar {
+		tmp := path + ".tmp"
+		if err := download(ctx, src.URL, tmp); err != nil {
+			os.Remove(tmp)
+			return "", err
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			return "", err
+		}
+		ctx.Log().Info("Tarball vendored", "url", src.URL, "path", path)
+		return path, nil
+	}
+
+	if FileExists(path) {
+		err = gitCommand(ctx, src, "-C", path, "remote", "update", "--prune").Run()
+	} else {
+		err = gitCommand(ctx, src, "clone", "--mirror", "--quiet", src.URL, path).Run()
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to vendor %s: %v", src.URL, err)
+	}
+	ctx.Log().Info("Repository vendored", "url", src.URL, "path", path)
+	return path, nil
+}
+
+// HasCommit reports whether the git repository at dir has the given commit.
+func HasCommit(ctx *bead.Context, dir, commit string) bool {
+	return revParse(ctx, dir, commit) != ""
+}
+
+// VendoredSource returns, in offline runs, the address under which a source
+// is read from config.VendorDir, keeping its subdirectory, ref and depth.
+// Sources that are not vendored, and all sources when not offline, are
+// returned as they are.
+func VendoredSource(source string) (string, error) {
+	src, err := ParseSource(source)
+	if err != nil || !config.Offline {
+		return source, err
+	}
+	path, ok := vendorPath(src)
+	if !ok {
+		return source, nil
+	}
+	if !FileExists(path) {
+		return "", fmt.Errorf("source %s is not vendored in %s, run `kado vendor` where the network is available", source, config.VendorDir)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	address := src.Kind + "::" + abs
+	if src.Subdir != "" {
+		address += "//" + filepath.ToSlash(src.Subdir)
+	}
+	query := url.Values{}
+	if src.Ref != "" {
+		query.Set("ref", src.Ref)
+	}
+	if src.Depth > 0 {
+		query.Set("depth", strconv.Itoa(src.Depth))
+	}
+	if len(query) > 0 {
+		address += "?" + query.Encode()
+	}
+	return address, nil
+}
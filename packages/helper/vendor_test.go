@@ -0,0 +1,69 @@
+package helper
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/janpreet/kado/packages/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func useVendorDir(t *testing.T) string {
+	previous := config.VendorDir
+	config.VendorDir = filepath.Join(t.TempDir(), "vendor")
+	t.Cleanup(func() {
+		config.VendorDir = previous
+		config.Offline = false
+	})
+	return config.VendorDir
+}
+
+func TestVendorSourceOffline(t *testing.T) {
+	vendorDir := useVendorDir(t)
+	source := sourceRepo(t)
+	address := "git::" + source + "//modules/vpc?ref=main"
+	ctx := testContext()
+
+	path, err := VendorSource(ctx, address)
+	require.NoError(t, err)
+	assert.Equal(t, vendorDir, filepath.Dir(path))
+	assert.True(t, HasCommit(ctx, path, git(t, source, "rev-parse", "HEAD")))
+
+	// Vendoring again updates the mirror.
+	writeMainTF(t, source, "v2")
+	git(t, source, "commit", "-q", "-am", "v2")
+	_, err = VendorSource(ctx, address)
+	require.NoError(t, err)
+	assert.True(t, HasCommit(ctx, path, git(t, source, "rev-parse", "HEAD")))
+
+	require.NoError(t, os.RemoveAll(source))
+	config.Offline = true
+	landingZone := t.TempDir()
+	_, err = CloneRepo(ctx, address, landingZone, "vpc", "")
+	require.NoError(t, err)
+	assert.Equal(t, "# vpc v2\n", readFile(t, filepath.Join(landingZone, "vpc", "main.tf")))
+
+	_, err = CloneRepo(ctx, "git@github.com:org/missing.git", landingZone, "missing", "")
+	assert.ErrorContains(t, err, "is not vendored")
+
+	dir := t.TempDir()
+	address, err = VendoredSource(dir)
+	require.NoError(t, err)
+	assert.Equal(t, dir, address)
+}
+
+func TestWriteArchive(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "vendor")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "repo.git", "refs"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "repo.git", "HEAD"), []byte("ref: refs/heads/main\n"), 0644))
+	archive := filepath.Join(t.TempDir(), "vendor.tar.gz")
+	require.NoError(t, WriteArchive(dir, archive))
+
+	landingZone := t.TempDir()
+	_, err := CloneRepo(testContext(), archive, landingZone, "extracted", "")
+	require.NoError(t, err)
+	assert.Equal(t, "ref: refs/heads/main\n", readFile(t, filepath.Join(landingZone, "extracted", "vendor", "repo.git", "HEAD")))
+	assert.DirExists(t, filepath.Join(landingZone, "extracted", "vendor", "repo.git", "refs"))
+}
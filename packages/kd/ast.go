@@ -0,0 +1,210 @@
+package kd
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Pos is a location in a .kd file. Line and Column are 1-based.
+type Pos struct {
+	File   string
+	Line   int
+	Column int
+}
+
+func (p Pos) String() string {
+	if p.Line == 0 {
+		return p.File
+	}
+	if p.File == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+// File is a parsed .kd file.
+type File struct {
+	Name string
+	Body *Body
+}
+
+// Body is the ordered content of a file or a block.
+type Body struct {
+	Items []Node
+	// End is the position of the closing brace, or of EOF for a file body.
+	End Pos
+}
+
+// Node is one of *Attribute, *Block or *Comment.
+type Node interface {
+	Start() Pos
+	// EndLine is the last source line the node occupies.
+	EndLine() int
+}
+
+// Attribute is a `name = value` assignment.
+type Attribute struct {
+	Name        string
+	NamePos     Pos
+	Value       *Value
+	LineComment string
+}
+
+func (a *Attribute) Start() Pos   { return a.NamePos }
+func (a *Attribute) EndLine() int { return a.Value.End.Line }
+
+// Block is a `type "label" ... { body }` declaration.
+type Block struct {
+	Type        string
+	TypePos     Pos
+	Labels      []string
+	LabelPos    []Pos
+	Body        *Body
+	LineComment string
+	// EndComment is a comment trailing the closing brace.
+	EndComment string
+}
+
+func (b *Block) Start() Pos   { return b.TypePos }
+func (b *Block) EndLine() int { return b.Body.End.Line }
+
+// Attributes returns the attributes declared directly in the block body.
+func (b *Block) Attributes() []*Attribute {
+	var attrs []*Attribute
+	for _, item := range b.Body.Items {
+		if a, ok := item.(*Attribute); ok {
+			attrs = append(attrs, a)
+		}
+	}
+	return attrs
+}
+
+// Blocks returns the blocks nested directly in the block body.
+func (b *Block) Blocks() []*Block {
+	var blocks []*Block
+	for _, item := range b.Body.Items {
+		if nested, ok := item.(*Block); ok {
+			blocks = append(blocks, nested)
+		}
+	}
+	return blocks
+}
+
+// Comment is a standalone comment line. Text includes the comment marker.
+type Comment struct {
+	Text string
+	Pos  Pos
+}
+
+func (c *Comment) Start() Pos   { return c.Pos }
+func (c *Comment) EndLine() int { return c.Pos.Line }
+
+// Kind identifies the type of a Value.
+type Kind int
+
+const (
+	StringKind Kind = iota
+	NumberKind
+	BoolKind
+	ListKind
+	MapKind
+	// IdentKind is a bare word such as `relay = opa`. It is treated as a
+	// string by consumers but keeps its spelling for the formatter.
+	IdentKind
+)
+
+func (k Kind) String() string {
+	switch k {
+	case StringKind:
+		return "string"
+	case NumberKind:
+		return "number"
+	case BoolKind:
+		return "bool"
+	case ListKind:
+		return "list"
+	case MapKind:
+		return "map"
+	case IdentKind:
+		return "identifier"
+	}
+	return "unknown"
+}
+
+// Value is a typed attribute value.
+type Value struct {
+	Kind Kind
+	Pos  Pos
+	End  Pos
+	// Raw is the source text of scalar values.
+	Raw    string
+	Str    string
+	Number float64
+	Bool   bool
+	List   []*Value
+	Map    []*MapEntry
+	// Comments are the comment lines above a list element and LineComment
+	// the comment that follows it on its line.
+	Comments    []string
+	LineComment string
+	// EndComments are the comment lines before the closing bracket or
+	// brace of a list or map.
+	EndComments []string
+}
+
+// MapEntry is a single key of a map value, kept in source order.
+type MapEntry struct {
+	Key    string
+	KeyPos Pos
+	Value  *Value
+	// Comments are the comment lines above the entry and LineComment the
+	// comment that follows it on its line.
+	Comments    []string
+	LineComment string
+}
+
+// Interface converts the value to plain Go types: string, float64, bool,
+// []interface{} and map[string]interface{}.
+func (v *Value) Interface() interface{} {
+	switch v.Kind {
+	case NumberKind:
+		return v.Number
+	case BoolKind:
+		return v.Bool
+	case ListKind:
+		list := make([]interface{}, 0, len(v.List))
+		for _, item := range v.List {
+			list = append(list, item.Interface())
+		}
+		return list
+	case MapKind:
+		m := make(map[string]interface{}, len(v.Map))
+		for _, entry := range v.Map {
+			m[entry.Key] = entry.Value.Interface()
+		}
+		return m
+	default:
+		return v.Str
+	}
+}
+
+// Error is a syntax error at a specific position.
+type Error struct {
+	Pos Pos
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Msg)
+}
+
+// ErrorList collects every syntax error found in a file.
+type ErrorList []*Error
+
+func (l ErrorList) Error() string {
+	msgs := make([]string, 0, len(l))
+	for _, e := range l {
+		msgs = append(msgs, e.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
@@ -0,0 +1,149 @@
+package kd
+
+import (
+	"strconv"
+	"strings"
+)
+
+const indentUnit = "  "
+
+// Format renders a parsed file in canonical style: two-space indentation,
+// one attribute per line, at most one blank line between items and comments
+// kept where they were written.
+func Format(f *File) []byte {
+	var sb strings.Builder
+	formatBody(&sb, f.Body, 0)
+	out := strings.TrimRight(sb.String(), "\n")
+	if out == "" {
+		return nil
+	}
+	return []byte(out + "\n")
+}
+
+func formatBody(sb *strings.Builder, body *Body, depth int) {
+	indent := strings.Repeat(indentUnit, depth)
+	prevLine := 0
+	for i, item := range body.Items {
+		if i > 0 && item.Start().Line > prevLine+1 {
+			sb.WriteString("\n")
+		}
+		prevLine = item.EndLine()
+
+		sb.WriteString(indent)
+		switch n := item.(type) {
+		case *Comment:
+			sb.WriteString(strings.TrimRight(n.Text, " \t"))
+		case *Attribute:
+			sb.WriteString(n.Name)
+			sb.WriteString(" = ")
+			formatValue(sb, n.Value, depth)
+			writeLineComment(sb, n.LineComment)
+		case *Block:
+			sb.WriteString(n.Type)
+			for _, label := range n.Labels {
+				sb.WriteString(" ")
+				sb.WriteString(strconv.Quote(label))
+			}
+			sb.WriteString(" {")
+			writeLineComment(sb, n.LineComment)
+			sb.WriteString("\n")
+			formatBody(sb, n.Body, depth+1)
+			sb.WriteString(indent)
+			sb.WriteString("}")
+			writeLineComment(sb, n.EndComment)
+		}
+		sb.WriteString("\n")
+	}
+}
+
+func writeLineComment(sb *strings.Builder, comment string) {
+	if comment != "" {
+		sb.WriteString(" ")
+		sb.WriteString(strings.TrimRight(comment, " \t"))
+	}
+}
+
+// writeComments writes comment lines at indent.
+func writeComments(sb *strings.Builder, comments []string, indent string) {
+	for _, comment := range comments {
+		sb.WriteString(indent + strings.TrimRight(comment, " \t") + "\n")
+	}
+}
+
+// formatValue writes scalars as they were spelled in the source. Lists and
+// maps stay on one line when they were written on one line and are expanded
+// to one element per line otherwise, keeping the comments among them.
+func formatValue(sb *strings.Builder, v *Value, depth int) {
+	multiline := v.End.Line > v.Pos.Line
+	indent := strings.Repeat(indentUnit, depth)
+	switch v.Kind {
+	case ListKind:
+		if len(v.List) == 0 && len(v.EndComments) == 0 {
+			sb.WriteString("[]")
+			return
+		}
+		if !multiline {
+			sb.WriteString("[")
+			for i, item := range v.List {
+				if i > 0 {
+					sb.WriteString(", ")
+				}
+				formatValue(sb, item, depth)
+			}
+			sb.WriteString("]")
+			return
+		}
+		sb.WriteString("[\n")
+		for _, item := range v.List {
+			writeComments(sb, item.Comments, indent+indentUnit)
+			sb.WriteString(indent + indentUnit)
+			formatValue(sb, item, depth+1)
+			sb.WriteString(",")
+			writeLineComment(sb, item.LineComment)
+			sb.WriteString("\n")
+		}
+		writeComments(sb, v.EndComments, indent+indentUnit)
+		sb.WriteString(indent + "]")
+	case MapKind:
+		if len(v.Map) == 0 && len(v.EndComments) == 0 {
+			sb.WriteString("{}")
+			return
+		}
+		if !multiline {
+			sb.WriteString("{ ")
+			for i, entry := range v.Map {
+				if i > 0 {
+					sb.WriteString(", ")
+				}
+				sb.WriteString(formatKey(entry.Key) + " = ")
+				formatValue(sb, entry.Value, depth)
+			}
+			sb.WriteString(" }")
+			return
+		}
+		sb.WriteString("{\n")
+		for _, entry := range v.Map {
+			writeComments(sb, entry.Comments, indent+indentUnit)
+			sb.WriteString(indent + indentUnit + formatKey(entry.Key) + " = ")
+			formatValue(sb, entry.Value, depth+1)
+			writeLineComment(sb, entry.LineComment)
+			sb.WriteString("\n")
+		}
+		writeComments(sb, v.EndComments, indent+indentUnit)
+		sb.WriteString(indent + "}")
+	default:
+		sb.WriteString(v.Raw)
+	}
+}
+
+func formatKey(key string) string {
+	if key == "" || !isIdentStart(rune(key[0])) {
+		return strconv.Quote(key)
+	}
+	for _, r := range key {
+		if !isIdentPart(r) {
+			return strconv.Quote(key)
+		}
+	}
+	return key
+}
@@ -0,0 +1,60 @@
+package kd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatKeepsCommentsInListsAndMaps(t *testing.T) {
+	src := `bead "ansible" "configure" {
+  depends_on = [
+    # network must exist first
+    "network",
+    "compute", # the VMs
+    # "policy",
+  ]
+  extra_vars = {
+    # defaults for every host
+    user = "ubuntu" # cloud image user
+    port = 22
+    # debug = true
+  }
+}
+`
+	f, err := Parse("fmt.kd", []byte(src))
+	require.NoError(t, err)
+	out := Format(f)
+	assert.Equal(t, src, string(out))
+
+	value := f.Body.Items[0].(*Block).Attributes()[0].Value
+	assert.Equal(t, []interface{}{"network", "compute"}, value.Interface())
+	assert.Equal(t, []string{"# network must exist first"}, value.List[0].Comments)
+	assert.Equal(t, "# the VMs", value.List[1].LineComment)
+	assert.Equal(t, []string{`# "policy",`}, value.EndComments)
+
+	again, err := Parse("fmt.kd", out)
+	require.NoError(t, err)
+	assert.Equal(t, src, string(Format(again)))
+
+	messy := `x = ["a" # first
+  , "b"
+  # last
+]
+y = {
+  a = 1, # one
+}
+`
+	f, err = Parse("fmt.kd", []byte(messy))
+	require.NoError(t, err)
+	assert.Equal(t, `x = [
+  "a", # first
+  "b",
+  # last
+]
+y = {
+  a = 1 # one
+}
+`, string(Format(f)))
+}
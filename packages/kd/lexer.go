@@ -0,0 +1,362 @@
+package kd
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenType int
+
+const (
+	tokEOF tokenType = iota
+	tokNewline
+	tokComment
+	tokIdent
+	tokString
+	tokNumber
+	tokHeredoc
+	tokLBrace
+	tokRBrace
+	tokLBrack
+	tokRBrack
+	tokEquals
+	tokColon
+	tokComma
+	tokIllegal
+)
+
+func (t tokenType) String() string {
+	switch t {
+	case tokEOF:
+		return "end of file"
+	case tokNewline:
+		return "newline"
+	case tokComment:
+		return "comment"
+	case tokIdent:
+		return "identifier"
+	case tokString:
+		return "string"
+	case tokNumber:
+		return "number"
+	case tokHeredoc:
+		return "heredoc"
+	case tokLBrace:
+		return `"{"`
+	case tokRBrace:
+		return `"}"`
+	case tokLBrack:
+		return `"["`
+	case tokRBrack:
+		return `"]"`
+	case tokEquals:
+		return `"="`
+	case tokColon:
+		return `":"`
+	case tokComma:
+		return `","`
+	}
+	return "illegal token"
+}
+
+type token struct {
+	typ tokenType
+	pos Pos
+	end Pos
+	// raw is the exact source text of the token.
+	raw string
+	// val is the decoded value for strings and heredocs.
+	val string
+}
+
+type lexer struct {
+	src    string
+	file   string
+	offset int
+	line   int
+	col    int
+	errors ErrorList
+}
+
+func newLexer(file, src string) *lexer {
+	return &lexer{src: src, file: file, line: 1, col: 1}
+}
+
+func (l *lexer) pos() Pos {
+	return Pos{File: l.file, Line: l.line, Column: l.col}
+}
+
+func (l *lexer) peek() rune {
+	if l.offset >= len(l.src) {
+		return -1
+	}
+	r, _ := utf8.DecodeRuneInString(l.src[l.offset:])
+	return r
+}
+
+func (l *lexer) peekAt(n int) byte {
+	if l.offset+n >= len(l.src) {
+		return 0
+	}
+	return l.src[l.offset+n]
+}
+
+func (l *lexer) advance() rune {
+	r, size := utf8.DecodeRuneInString(l.src[l.offset:])
+	l.offset += size
+	if r == '\n' {
+		l.line++
+		l.col = 1
+	} else {
+		l.col++
+	}
+	return r
+}
+
+func (l *lexer) errorf(pos Pos, format string, args ...interface{}) {
+	l.errors = append(l.errors, &Error{Pos: pos, Msg: fmt.Sprintf(format, args...)})
+}
+
+func (l *lexer) tokens() []token {
+	var toks []token
+	for {
+		tok := l.next()
+		toks = append(toks, tok)
+		if tok.typ == tokEOF {
+			return toks
+		}
+	}
+}
+
+func (l *lexer) next() token {
+	for {
+		r := l.peek()
+		if r == ' ' || r == '\t' || r == '\r' {
+			l.advance()
+			continue
+		}
+		break
+	}
+
+	start := l.pos()
+	startOffset := l.offset
+	emit := func(typ tokenType, val string) token {
+		return token{typ: typ, pos: start, end: l.pos(), raw: l.src[startOffset:l.offset], val: val}
+	}
+
+	r := l.peek()
+	switch {
+	case r == -1:
+		return token{typ: tokEOF, pos: start, end: start}
+	case r == '\n':
+		l.advance()
+		return emit(tokNewline, "")
+	case r == '#' || (r == '/' && l.peekAt(1) == '/'):
+		for l.peek() != '\n' && l.peek() != -1 {
+			l.advance()
+		}
+		return emit(tokComment, "")
+	case r == '{':
+		l.advance()
+		return emit(tokLBrace, "")
+	case r == '}':
+		l.advance()
+		return emit(tokRBrace, "")
+	case r == '[':
+		l.advance()
+		return emit(tokLBrack, "")
+	case r == ']':
+		l.advance()
+		return emit(tokRBrack, "")
+	case r == '=':
+		l.advance()
+		return emit(tokEquals, "")
+	case r == ':':
+		l.advance()
+		return emit(tokColon, "")
+	case r == ',':
+		l.advance()
+		return emit(tokComma, "")
+	case r == '"':
+		val := l.scanString(start)
+		return emit(tokString, val)
+	case r == '<' && l.peekAt(1) == '<':
+		val, ok := l.scanHeredoc(start)
+		if !ok {
+			return emit(tokIllegal, "")
+		}
+		return emit(tokHeredoc, val)
+	case r == '-' || (r >= '0' && r <= '9'):
+		if l.scanNumber() {
+			return emit(tokNumber, "")
+		}
+		l.errorf(start, "invalid number %q", l.src[startOffset:l.offset])
+		return emit(tokIllegal, "")
+	case isIdentStart(r):
+		for isIdentPart(l.peek()) {
+			l.advance()
+		}
+		return emit(tokIdent, "")
+	}
+
+	l.advance()
+	l.errorf(start, "unexpected character %q", r)
+	return emit(tokIllegal, "")
+}
+
+func (l *lexer) scanString(start Pos) string {
+	var sb strings.Builder
+	l.advance()
+	for {
+		r := l.peek()
+		switch r {
+		case -1, '\n':
+			l.errorf(start, "unterminated string")
+			return sb.String()
+		case '"':
+			l.advance()
+			return sb.String()
+		case '\\':
+			escPos := l.pos()
+			l.advance()
+			switch esc := l.peek(); esc {
+			case '"', '\\':
+				sb.WriteRune(l.advance())
+			case 'n':
+				l.advance()
+				sb.WriteByte('\n')
+			case 't':
+				l.advance()
+				sb.WriteByte('\t')
+			case 'r':
+				l.advance()
+				sb.WriteByte('\r')
+			default:
+				l.errorf(escPos, "unknown escape sequence \\%c", esc)
+				if esc != -1 && esc != '\n' {
+					l.advance()
+				}
+			}
+		default:
+			sb.WriteRune(l.advance())
+		}
+	}
+}
+
+// scanHeredoc reads `<<MARKER` or `<<-MARKER` up to a line holding only the
+// marker. The indented form strips the common leading whitespace.
+func (l *lexer) scanHeredoc(start Pos) (string, bool) {
+	l.advance()
+	l.advance()
+	indent := false
+	if l.peek() == '-' {
+		indent = true
+		l.advance()
+	}
+	markerStart := l.offset
+	for isIdentPart(l.peek()) {
+		l.advance()
+	}
+	marker := l.src[markerStart:l.offset]
+	if marker == "" || l.peek() != '\n' {
+		l.errorf(start, "heredoc marker must be an identifier followed by a newline")
+		return "", false
+	}
+	l.advance()
+
+	var lines []string
+	for {
+		if l.peek() == -1 {
+			l.errorf(start, "unterminated heredoc, expected closing %q", marker)
+			return "", false
+		}
+		lineStart := l.offset
+		for l.peek() != '\n' && l.peek() != -1 {
+			l.advance()
+		}
+		line := l.src[lineStart:l.offset]
+		if strings.TrimSpace(line) == marker {
+			break
+		}
+		lines = append(lines, line)
+		if l.peek() == '\n' {
+			l.advance()
+		}
+	}
+
+	if indent {
+		lines = dedent(lines)
+	}
+	if len(lines) == 0 {
+		return "", true
+	}
+	return strings.Join(lines, "\n") + "\n", true
+}
+
+func dedent(lines []string) []string {
+	prefix := -1
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		n := len(line) - len(strings.TrimLeft(line, " \t"))
+		if prefix == -1 || n < prefix {
+			prefix = n
+		}
+	}
+	if prefix <= 0 {
+		return lines
+	}
+	out := make([]string, len(lines))
+	for i, line := range lines {
+		if len(line) >= prefix {
+			out[i] = line[prefix:]
+		} else {
+			out[i] = strings.TrimLeft(line, " \t")
+		}
+	}
+	return out
+}
+
+func (l *lexer) scanNumber() bool {
+	if l.peek() == '-' {
+		l.advance()
+	}
+	digits := func() int {
+		n := 0
+		for r := l.peek(); r >= '0' && r <= '9'; r = l.peek() {
+			l.advance()
+			n++
+		}
+		return n
+	}
+	if digits() == 0 {
+		return false
+	}
+	if l.peek() == '.' {
+		l.advance()
+		if digits() == 0 {
+			return false
+		}
+	}
+	if r := l.peek(); r == 'e' || r == 'E' {
+		l.advance()
+		if r := l.peek(); r == '+' || r == '-' {
+			l.advance()
+		}
+		if digits() == 0 {
+			return false
+		}
+	}
+	return !isIdentPart(l.peek())
+}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isIdentPart(r rune) bool {
+	return r == '_' || r == '-' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,85 @@
+package kd
+
+import (
+	"sort"
+	"strings"
+)
+
+// Diagnostic is a single lint finding.
+type Diagnostic struct {
+	Pos     Pos
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return d.Pos.String() + ": " + d.Message
+}
+
+// Lint parses src and reports syntax errors together with style problems:
+// indentation, brace placement, nested beads and runs of blank lines.
+func Lint(filename string, src []byte) []Diagnostic {
+	var diags []Diagnostic
+	f, err := Parse(filename, src)
+	if errs, ok := err.(ErrorList); ok {
+		for _, e := range errs {
+			diags = append(diags, Diagnostic{Pos: e.Pos, Message: e.Msg})
+		}
+	}
+	lintBody(f.Body, 0, &diags)
+
+	emptyLines := 0
+	for i, line := range strings.Split(string(src), "\n") {
+		if strings.TrimSpace(line) != "" {
+			emptyLines = 0
+			continue
+		}
+		emptyLines++
+		if emptyLines > 1 {
+			diags = append(diags, Diagnostic{
+				Pos:     Pos{File: filename, Line: i + 1, Column: 1},
+				Message: "Multiple consecutive empty lines are not allowed",
+			})
+		}
+	}
+
+	sort.SliceStable(diags, func(i, j int) bool {
+		if diags[i].Pos.Line != diags[j].Pos.Line {
+			return diags[i].Pos.Line < diags[j].Pos.Line
+		}
+		return diags[i].Pos.Column < diags[j].Pos.Column
+	})
+	return diags
+}
+
+func lintBody(body *Body, depth int, diags *[]Diagnostic) {
+	wantColumn := len(indentUnit)*depth + 1
+	report := func(pos Pos, msg string) {
+		*diags = append(*diags, Diagnostic{Pos: pos, Message: msg})
+	}
+	for _, item := range body.Items {
+		pos := item.Start()
+		block, isBlock := item.(*Block)
+		switch {
+		case isBlock && block.Type == "bead" && depth > 0:
+			report(pos, "Nested beads are not allowed")
+		case pos.Column == wantColumn:
+		case depth == 0 && isBlock:
+			report(pos, "Bead declaration should start at the beginning of the line")
+		case depth == 0:
+			if _, ok := item.(*Comment); ok {
+				report(pos, "Comments should start at the beginning of the line")
+			} else {
+				report(pos, "Non-bead content should not be indented")
+			}
+		default:
+			report(pos, "Bead content should be indented with two spaces")
+		}
+		if !isBlock {
+			continue
+		}
+		if end := block.Body.End; end.Line > block.TypePos.Line && end.Column != pos.Column {
+			report(end, "Closing brace should be at the beginning of the line")
+		}
+		lintBody(block.Body, depth+1, diags)
+	}
+}
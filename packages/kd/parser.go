@@ -0,0 +1,341 @@
+// Package kd parses .kd bead definition files.
+//
+// The syntax is a subset of HCL: a file is a sequence of attributes
+// (`name = value`) and blocks (`type "label" { ... }`), values are strings,
+// heredocs, numbers, booleans, bare identifiers, lists and maps, and
+// comments start with `#` or `//`.
+package kd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+type parser struct {
+	toks   []token
+	i      int
+	errors ErrorList
+}
+
+// ParseFile reads and parses a .kd file.
+func ParseFile(filename string) (*File, error) {
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(filename, src)
+}
+
+// Parse parses src as the contents of filename. On syntax errors it returns
+// the partial AST together with an ErrorList describing every problem found.
+func Parse(filename string, src []byte) (*File, error) {
+	lex := newLexer(filename, string(src))
+	p := &parser{toks: lex.tokens()}
+	p.errors = append(p.errors, lex.errors...)
+
+	f := &File{Name: filename, Body: p.parseBody(nil)}
+	if len(p.errors) > 0 {
+		return f, p.errors
+	}
+	return f, nil
+}
+
+func (p *parser) tok() token {
+	return p.toks[p.i]
+}
+
+func (p *parser) peekType(n int) tokenType {
+	if p.i+n >= len(p.toks) {
+		return tokEOF
+	}
+	return p.toks[p.i+n].typ
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.i]
+	if t.typ != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) errorf(pos Pos, format string, args ...interface{}) {
+	p.errors = append(p.errors, &Error{Pos: pos, Msg: fmt.Sprintf(format, args...)})
+}
+
+// sync skips the rest of the current line after an error.
+func (p *parser) sync() {
+	for t := p.tok().typ; t != tokNewline && t != tokEOF; t = p.tok().typ {
+		p.next()
+	}
+}
+
+// comments skips newlines and returns the comment lines among them.
+func (p *parser) comments() []string {
+	var comments []string
+	for {
+		switch t := p.tok(); t.typ {
+		case tokNewline:
+			p.next()
+		case tokComment:
+			p.next()
+			comments = append(comments, t.raw)
+		default:
+			return comments
+		}
+	}
+}
+
+// lineComment consumes a comment that follows a list element or map entry.
+func (p *parser) lineComment() string {
+	if p.tok().typ == tokComment {
+		return p.next().raw
+	}
+	return ""
+}
+
+// parseBody parses items until the closing brace of open, or EOF when open
+// is nil.
+func (p *parser) parseBody(open *token) *Body {
+	body := &Body{}
+	seen := make(map[string]Pos)
+	for {
+		t := p.tok()
+		switch t.typ {
+		case tokNewline:
+			p.next()
+		case tokComment:
+			p.next()
+			body.Items = append(body.Items, &Comment{Text: t.raw, Pos: t.pos})
+		case tokEOF:
+			if open != nil {
+				p.errorf(open.pos, "unclosed block, expected \"}\" before end of file")
+			}
+			body.End = t.pos
+			return body
+		case tokRBrace:
+			p.next()
+			if open == nil {
+				p.errorf(t.pos, "unexpected \"}\" outside of a block")
+				continue
+			}
+			body.End = t.pos
+			return body
+		case tokIdent:
+			switch p.peekType(1) {
+			case tokEquals:
+				attr := p.parseAttribute()
+				if attr == nil {
+					continue
+				}
+				if prev, ok := seen[attr.Name]; ok {
+					p.errorf(attr.NamePos, "duplicate attribute %q, previously defined at %d:%d", attr.Name, prev.Line, prev.Column)
+				} else {
+					seen[attr.Name] = attr.NamePos
+				}
+				body.Items = append(body.Items, attr)
+			case tokString, tokIdent, tokLBrace:
+				if block := p.parseBlock(); block != nil {
+					body.Items = append(body.Items, block)
+				}
+			default:
+				next := p.toks[p.i+1]
+				p.errorf(next.pos, "expected \"=\" or block after %q, found %s", t.raw, next.typ)
+				p.sync()
+			}
+		default:
+			p.errorf(t.pos, "expected attribute or block, found %s", t.typ)
+			p.next()
+			p.sync()
+		}
+	}
+}
+
+func (p *parser) parseAttribute() *Attribute {
+	name := p.next()
+	p.next()
+	value := p.parseValue()
+	if value == nil {
+		p.sync()
+		return nil
+	}
+	attr := &Attribute{Name: name.raw, NamePos: name.pos, Value: value}
+	attr.LineComment = p.endOfLine()
+	return attr
+}
+
+func (p *parser) parseBlock() *Block {
+	typ := p.next()
+	block := &Block{Type: typ.raw, TypePos: typ.pos}
+	for {
+		t := p.tok()
+		switch t.typ {
+		case tokString:
+			p.next()
+			block.Labels = append(block.Labels, t.val)
+			block.LabelPos = append(block.LabelPos, t.pos)
+			continue
+		case tokIdent:
+			p.next()
+			block.Labels = append(block.Labels, t.raw)
+			block.LabelPos = append(block.LabelPos, t.pos)
+			continue
+		case tokLBrace:
+		default:
+			p.errorf(t.pos, "expected block label or \"{\", found %s", t.typ)
+			p.sync()
+			return nil
+		}
+		break
+	}
+	open := p.next()
+	if p.tok().typ == tokComment {
+		block.LineComment = p.next().raw
+	}
+	block.Body = p.parseBody(&open)
+	block.EndComment = p.endOfLine()
+	return block
+}
+
+// endOfLine consumes an optional trailing comment and the line terminator.
+// A closing brace may also end the line; it is left for the caller.
+func (p *parser) endOfLine() string {
+	comment := ""
+	if p.tok().typ == tokComment {
+		comment = p.next().raw
+	}
+	switch t := p.tok(); t.typ {
+	case tokNewline:
+		p.next()
+	case tokEOF, tokRBrace:
+	default:
+		p.errorf(t.pos, "expected newline, found %s", t.typ)
+		p.sync()
+	}
+	return comment
+}
+
+func (p *parser) parseValue() *Value {
+	t := p.tok()
+	switch t.typ {
+	case tokString, tokHeredoc:
+		p.next()
+		return &Value{Kind: StringKind, Pos: t.pos, End: t.end, Raw: t.raw, Str: t.val}
+	case tokNumber:
+		p.next()
+		n, err := strconv.ParseFloat(t.raw, 64)
+		if err != nil {
+			p.errorf(t.pos, "invalid number %q", t.raw)
+			return nil
+		}
+		return &Value{Kind: NumberKind, Pos: t.pos, End: t.end, Raw: t.raw, Number: n}
+	case tokIdent:
+		p.next()
+		switch t.raw {
+		case "true", "false":
+			return &Value{Kind: BoolKind, Pos: t.pos, End: t.end, Raw: t.raw, Bool: t.raw == "true"}
+		}
+		return &Value{Kind: IdentKind, Pos: t.pos, End: t.end, Raw: t.raw, Str: t.raw}
+	case tokLBrack:
+		return p.parseList()
+	case tokLBrace:
+		return p.parseMap()
+	case tokNewline, tokEOF, tokComment:
+		p.errorf(t.pos, "missing value")
+		return nil
+	}
+	p.errorf(t.pos, "expected value, found %s", t.typ)
+	return nil
+}
+
+func (p *parser) parseList() *Value {
+	open := p.next()
+	list := &Value{Kind: ListKind, Pos: open.pos}
+	var pending []string
+	for {
+		comments := append(pending, p.comments()...)
+		if t := p.tok(); t.typ == tokRBrack {
+			p.next()
+			list.End = t.end
+			list.EndComments = comments
+			return list
+		}
+		item := p.parseValue()
+		if item == nil {
+			return nil
+		}
+		item.Comments = comments
+		item.LineComment = p.lineComment()
+		list.List = append(list.List, item)
+		// Comment lines after an element and before its comma, or the
+		// closing bracket, belong to what follows.
+		pending = p.comments()
+		switch t := p.tok(); t.typ {
+		case tokComma:
+			p.next()
+			if item.LineComment == "" {
+				item.LineComment = p.lineComment()
+			}
+		case tokRBrack:
+		default:
+			p.errorf(t.pos, "expected \",\" or \"]\" in list, found %s", t.typ)
+			return nil
+		}
+	}
+}
+
+func (p *parser) parseMap() *Value {
+	open := p.next()
+	m := &Value{Kind: MapKind, Pos: open.pos}
+	seen := make(map[string]bool)
+	for {
+		comments := p.comments()
+		t := p.tok()
+		if t.typ == tokRBrace {
+			p.next()
+			m.End = t.end
+			m.EndComments = comments
+			return m
+		}
+		var key string
+		switch t.typ {
+		case tokIdent:
+			key = t.raw
+		case tokString:
+			key = t.val
+		default:
+			p.errorf(t.pos, "expected map key, found %s", t.typ)
+			return nil
+		}
+		p.next()
+		if sep := p.tok(); sep.typ != tokEquals && sep.typ != tokColon {
+			p.errorf(sep.pos, "expected \"=\" after map key %q, found %s", key, sep.typ)
+			return nil
+		}
+		p.next()
+		value := p.parseValue()
+		if value == nil {
+			return nil
+		}
+		if seen[key] {
+			p.errorf(t.pos, "duplicate map key %q", key)
+		}
+		seen[key] = true
+		entry := &MapEntry{Key: key, KeyPos: t.pos, Value: value, Comments: comments}
+		m.Map = append(m.Map, entry)
+		switch sep := p.tok(); sep.typ {
+		case tokComma:
+			p.next()
+			entry.LineComment = p.lineComment()
+		case tokComment:
+			entry.LineComment = p.next().raw
+		case tokNewline:
+			p.next()
+		case tokRBrace:
+		default:
+			p.errorf(sep.pos, "expected \",\", newline or \"}\" in map, found %s", sep.typ)
+			return nil
+		}
+	}
+}
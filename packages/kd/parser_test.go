@@ -0,0 +1,150 @@
+package kd
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTypedValues(t *testing.T) {
+	src := `# leading comment
+bead "terraform" {
+  source = "git@github.com:janpreet/proxmox_terraform.git"
+  enabled = true
+  count = 3
+  relay = opa
+  escaped = "say \"hi\" a=b"
+  depends_on = [
+    "network",
+    "dns",
+  ]
+  labels = { env = "prod", "team-name": "infra" }
+  script = <<-EOT
+    echo one
+    echo two
+  EOT
+}
+`
+	f, err := Parse("test.kd", []byte(src))
+	require.NoError(t, err)
+	require.Len(t, f.Body.Items, 2)
+
+	block := f.Body.Items[1].(*Block)
+	assert.Equal(t, "bead", block.Type)
+	assert.Equal(t, []string{"terraform"}, block.Labels)
+	assert.Equal(t, Pos{File: "test.kd", Line: 2, Column: 1}, block.TypePos)
+
+	attrs := map[string]*Value{}
+	for _, a := range block.Attributes() {
+		attrs[a.Name] = a.Value
+	}
+	assert.Equal(t, StringKind, attrs["source"].Kind)
+	assert.Equal(t, true, attrs["enabled"].Interface())
+	assert.Equal(t, float64(3), attrs["count"].Interface())
+	assert.Equal(t, IdentKind, attrs["relay"].Kind)
+	assert.Equal(t, "opa", attrs["relay"].Interface())
+	assert.Equal(t, `say "hi" a=b`, attrs["escaped"].Str)
+	assert.Equal(t, []interface{}{"network", "dns"}, attrs["depends_on"].Interface())
+	assert.Equal(t, []interface{}{"network", "dns"}, attrs["depends_on"].Interface())
+	assert.Equal(t, map[string]interface{}{"env": "prod", "team-name": "infra"}, attrs["labels"].Interface())
+	assert.Equal(t, "echo one\necho two\n", attrs["script"].Str)
+	assert.Equal(t, 8, attrs["depends_on"].Pos.Line)
+}
+
+func TestParseErrorsHavePositions(t *testing.T) {
+	src := `bead "ansible" {
+  playbook = "cluster.yaml
+  enabled =
+  enabled = true
+  enabled = false
+`
+	_, err := Parse("bad.kd", []byte(src))
+	require.Error(t, err)
+	errs, ok := err.(ErrorList)
+	require.True(t, ok)
+
+	var msgs []string
+	for _, e := range errs {
+		msgs = append(msgs, e.Error())
+	}
+	assert.Contains(t, msgs, "bad.kd:2:14: unterminated string")
+	assert.Contains(t, msgs, "bad.kd:3:12: missing value")
+	assert.Contains(t, msgs, "bad.kd:5:3: duplicate attribute \"enabled\", previously defined at 4:3")
+	assert.Contains(t, msgs, "bad.kd:1:16: unclosed block, expected \"}\" before end of file")
+}
+
+func TestFormatIsStable(t *testing.T) {
+	src := `# Comment
+bead "ansible" {
+    enabled = false
+  relay = opa   # trailing
+  #  extra_vars = "a=b"
+  hosts = ["a",
+    "b"]
+
+
+}
+
+bead "opa" {
+enabled = true
+}
+`
+	f, err := Parse("fmt.kd", []byte(src))
+	require.NoError(t, err)
+	want := `# Comment
+bead "ansible" {
+  enabled = false
+  relay = opa # trailing
+  #  extra_vars = "a=b"
+  hosts = [
+    "a",
+    "b",
+  ]
+}
+
+bead "opa" {
+  enabled = true
+}
+`
+	out := Format(f)
+	assert.Equal(t, want, string(out))
+
+	again, err := Parse("fmt.kd", out)
+	require.NoError(t, err)
+	assert.Equal(t, want, string(Format(again)))
+}
+
+func TestFormatRepositoryFilesUnchanged(t *testing.T) {
+	for _, name := range []string{"../../cluster.kd", "../../relay.kd"} {
+		src, err := os.ReadFile(name)
+		require.NoError(t, err)
+		f, err := Parse(name, src)
+		require.NoError(t, err)
+		assert.Equal(t, string(src), string(Format(f)), name)
+	}
+}
+
+func TestLint(t *testing.T) {
+	src := `  bead "ansible" {
+ enabled = true
+  bead "nested" {
+  }
+ }
+
+
+# fine
+`
+	var msgs []string
+	for _, d := range Lint("lint.kd", []byte(src)) {
+		msgs = append(msgs, d.String())
+	}
+	assert.Equal(t, []string{
+		"lint.kd:1:3: Bead declaration should start at the beginning of the line",
+		"lint.kd:2:2: Bead content should be indented with two spaces",
+		"lint.kd:3:3: Nested beads are not allowed",
+		"lint.kd:5:2: Closing brace should be at the beginning of the line",
+		"lint.kd:7:1: Multiple consecutive empty lines are not allowed",
+	}, msgs)
+}
@@ -3,7 +3,7 @@ package keybase
 import (
 	"fmt"
 	"os"
-	"log"
+	"log/slog"
 	"os/exec"
 	"path/filepath"
 	"strings"
@@ -140,7 +140,7 @@ func CreateNote(noteName, content string) error {
 
     if err := gitAddCommit(notePath, "Create note "+noteName); err != nil {
         // Log the error but don't fail the note creation
-        log.Printf("WARNING: Failed to version note: %v", err)
+        slog.Warn("Failed to version note", "note", noteName, "error", err)
     }
 
     if Debug {
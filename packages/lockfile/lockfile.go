@@ -0,0 +1,123 @@
+// Package lockfile reads and writes kado.lock, which pins every git source
+// of the beads to the commit it resolved to, so runs use the exact same
+// code until the lock file is updated.
+package lockfile
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+// FileName is the name of the lock file, next to the .kd files.
+const FileName = "kado.lock"
+
+// Entry records the commit a source and ref resolved to and the beads that
+// use it.
+type Entry struct {
+	Source string   `json:"source"`
+	Ref    string   `json:"ref,omitempty"`
+	Commit string   `json:"commit"`
+	Beads  []string `json:"beads"`
+}
+
+// File is the content of a lock file. It is safe for concurrent use.
+type File struct {
+	Sources []Entry `json:"sources"`
+
+	mu      sync.Mutex
+	changed bool
+}
+
+// Read loads the lock file at path. A missing file is an empty lock file.
+func Read(path string) (*File, error) {
+	f := &File{}
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lock file: %v", err)
+	}
+	if err := json.Unmarshal(content, f); err != nil {
+		return nil, fmt.Errorf("failed to parse lock file %s: %v", path, err)
+	}
+	return f, nil
+}
+
+// Lookup returns the entry of a source and ref.
+func (f *File) Lookup(source, ref string) (Entry, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if i := f.index(source, ref); i >= 0 {
+		return f.Sources[i], true
+	}
+	return Entry{}, false
+}
+
+// Record notes that bead beadName resolved source and ref to commit.
+func (f *File) Record(beadName, source, ref, commit string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	i := f.index(source, ref)
+	if i < 0 {
+		f.Sources = append(f.Sources, Entry{Source: source, Ref: ref})
+		i = len(f.Sources) - 1
+		f.changed = true
+	}
+	entry := &f.Sources[i]
+	if entry.Commit != commit {
+		entry.Commit = commit
+		f.changed = true
+	}
+	for _, name := range entry.Beads {
+		if name == beadName {
+			return
+		}
+	}
+	entry.Beads = append(entry.Beads, beadName)
+	sort.Strings(entry.Beads)
+	f.changed = true
+}
+
+// Changed reports whether Record changed the file since it was read.
+func (f *File) Changed() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.changed
+}
+
+// Write saves the lock file to path, its entries ordered by source and ref.
+func (f *File) Write(path string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	sort.Slice(f.Sources, func(i, j int) bool {
+		if f.Sources[i].Source != f.Sources[j].Source {
+			return f.Sources[i].Source < f.Sources[j].Source
+		}
+		return f.Sources[i].Ref < f.Sources[j].Ref
+	})
+	if f.Sources == nil {
+		f.Sources = []Entry{}
+	}
+	content, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode lock file: %v", err)
+	}
+	if err := os.WriteFile(path, append(content, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write lock file: %v", err)
+	}
+	f.changed = false
+	return nil
+}
+
+func (f *File) index(source, ref string) int {
+	for i, entry := range f.Sources {
+		if entry.Source == source && entry.Ref == ref {
+			return i
+		}
+	}
+	return -1
+}
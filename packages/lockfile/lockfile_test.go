@@ -0,0 +1,48 @@
+package lockfile
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordAndWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	f, err := Read(path)
+	require.NoError(t, err)
+	assert.False(t, f.Changed())
+
+	f.Record("network", "git::https://example.com/infra.git//network", "main", "bbb")
+	f.Record("compute", "git::https://example.com/infra.git//compute", "main", "aaa")
+	f.Record("compute", "git::https://example.com/infra.git//compute", "main", "aaa")
+	f.Record("vpc", "git::https://example.com/infra.git//network", "main", "bbb")
+	assert.True(t, f.Changed())
+	require.NoError(t, f.Write(path))
+	assert.False(t, f.Changed())
+
+	f, err = Read(path)
+	require.NoError(t, err)
+	assert.Equal(t, []Entry{
+		{Source: "git::https://example.com/infra.git//compute", Ref: "main", Commit: "aaa", Beads: []string{"compute"}},
+		{Source: "git::https://example.com/infra.git//network", Ref: "main", Commit: "bbb", Beads: []string{"network", "vpc"}},
+	}, f.Sources)
+
+	f.Record("network", "git::https://example.com/infra.git//network", "main", "bbb")
+	assert.False(t, f.Changed())
+	f.Record("network", "git::https://example.com/infra.git//network", "main", "ccc")
+	assert.True(t, f.Changed())
+}
+
+func TestLookup(t *testing.T) {
+	f := &File{}
+	f.Record("network", "git@github.com:org/network.git", "main", "aaa")
+
+	entry, ok := f.Lookup("git@github.com:org/network.git", "main")
+	assert.True(t, ok)
+	assert.Equal(t, "aaa", entry.Commit)
+
+	_, ok = f.Lookup("git@github.com:org/network.git", "")
+	assert.False(t, ok)
+}
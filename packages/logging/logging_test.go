@@ -0,0 +1,38 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetupJSON(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+
+	var buf bytes.Buffer
+	require.NoError(t, Setup(&buf, FormatJSON, false))
+	slog.Debug("hidden")
+	slog.Info("Running terraform plan", "bead", "network", "phase", "plan")
+
+	var record map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "INFO", record["level"])
+	assert.Equal(t, "Running terraform plan", record["msg"])
+	assert.Equal(t, "network", record["bead"])
+	assert.Equal(t, "plan", record["phase"])
+}
+
+func TestSetupDebugAndUnknownFormat(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+
+	var buf bytes.Buffer
+	require.NoError(t, Setup(&buf, FormatText, true))
+	slog.Debug("visible")
+	assert.Contains(t, buf.String(), "level=DEBUG msg=visible")
+
+	assert.EqualError(t, Setup(&buf, "xml", false), `unknown log format "xml", expected text or json`)
+}
@@ -0,0 +1,132 @@
+package opa
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/janpreet/kado/packages/bead"
+	"github.com/janpreet/kado/packages/report"
+)
+
+// Rule names follow the conftest conventions: deny, violation and warn, each
+// optionally followed by an underscore and a suffix, e.g. deny_public_ip.
+var (
+	failureRule = regexp.MustCompile(`^(deny|violation)(_[a-zA-Z0-9_]+)*$`)
+	warningRule = regexp.MustCompile(`^warn(_[a-zA-Z0-9_]+)*$`)
+)
+
+// decide turns the value of the evaluated query into a decision.
+//
+// A boolean is read as an allow rule. A package document, e.g.
+// `package = "data.main"`, is read conftest-style: every deny and violation
+// rule in it fails the input and every warn rule only warns. A set queried
+// directly, e.g. `package = "data.main.deny"`, is read as the messages of the
+// rule named by the last segment of the query. An undefined query denies.
+func decide(query string, value interface{}) (report.Decision, error) {
+	d := report.Decision{Query: query}
+	switch v := value.(type) {
+	case nil:
+		return d, nil
+	case bool:
+		d.Allowed = v
+		return d, nil
+	case map[string]interface{}:
+		rules := make([]string, 0, len(v))
+		for rule := range v {
+			rules = append(rules, rule)
+		}
+		sort.Strings(rules)
+		for _, rule := range rules {
+			switch {
+			case failureRule.MatchString(rule):
+				d.Failures = append(d.Failures, messages(rule, v[rule])...)
+			case warningRule.MatchString(rule):
+				d.Warnings = append(d.Warnings, messages(rule, v[rule])...)
+			}
+		}
+	case []interface{}:
+		rule := query[strings.LastIndex(query, ".")+1:]
+		if warningRule.MatchString(rule) {
+			d.Warnings = messages(rule, v)
+		} else {
+			d.Failures = messages(rule, v)
+		}
+	default:
+		return d, fmt.Errorf("query %s returned %T, expected a boolean, a set of messages or a package", query, value)
+	}
+	d.Allowed = len(d.Failures) == 0
+	return d, nil
+}
+
+// messages reads the value of a single rule. Partial rules produce a set of
+// strings or of objects with a msg field; a complete rule that is true
+// produces a single message without text.
+func messages(rule string, value interface{}) []report.Message {
+	switch v := value.(type) {
+	case bool:
+		if v {
+			return []report.Message{{Rule: rule}}
+		}
+		return nil
+	case []interface{}:
+		var msgs []report.Message
+		for _, item := range v {
+			msgs = append(msgs, report.Message{Rule: rule, Msg: messageText(item)})
+		}
+		return msgs
+	default:
+		return []report.Message{{Rule: rule, Msg: messageText(v)}}
+	}
+}
+
+func messageText(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case map[string]interface{}:
+		if msg, ok := v["msg"].(string); ok {
+			return msg
+		}
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+// printDecision writes the messages of a decision to the bead's output in
+// the format conftest uses, followed by a summary line.
+func printDecision(ctx *bead.Context, d report.Decision) {
+	if len(d.Failures) == 0 && len(d.Warnings) == 0 {
+		return
+	}
+	var w io.Writer = os.Stdout
+	if ctx.Stdout != nil {
+		w = ctx.Stdout
+	}
+	for _, m := range d.Warnings {
+		fmt.Fprintf(w, "WARN - %s - %s - %s\n", d.Query, m.Rule, m.Msg)
+	}
+	for _, m := range d.Failures {
+		fmt.Fprintf(w, "FAIL - %s - %s - %s\n", d.Query, m.Rule, m.Msg)
+	}
+	fmt.Fprintf(w, "%d failure(s), %d warning(s)\n", len(d.Failures), len(d.Warnings))
+}
+
+// denial is the error returned when a decision denies the input.
+func denial(d report.Decision) error {
+	if len(d.Failures) == 0 {
+		return fmt.Errorf("input denied by policy %s", d.Query)
+	}
+	msgs := make([]string, len(d.Failures))
+	for i, m := range d.Failures {
+		msgs[i] = m.String()
+	}
+	return fmt.Errorf("input denied by policy %s: %s", d.Query, strings.Join(msgs, "; "))
+}
@@ -0,0 +1,76 @@
+package opa
+
+import (
+	"fmt"
+
+	"github.com/janpreet/kado/packages/bead"
+)
+
+// Handler evaluates OPA policy beads.
+type Handler struct{}
+
+// Enforcement modes of an OPA bead. A block denial fails the bead, so the
+// origin is not applied and the beads depending on it are skipped. A warn
+// denial prints the messages and carries on; an audit denial is only
+// recorded in the run report.
+const (
+	EnforcementBlock = "block"
+	EnforcementWarn  = "warn"
+	EnforcementAudit = "audit"
+)
+
+// enforcement returns the bead's enforcement mode, block by default.
+func enforcement(b bead.Bead) string {
+	if mode := b.Fields["enforcement"]; mode != "" {
+		return mode
+	}
+	return EnforcementBlock
+}
+
+func init() {
+	bead.Register("opa", Handler{})
+}
+
+// Schema declares the fields of OPA beads.
+func (Handler) Schema() []bead.Field {
+	return []bead.Field{
+		{Name: "input", Type: bead.TypeString, Description: "JSON or YAML document to evaluate. Defaults to the saved plan of a relaying terraform or terragrunt bead."},
+		{Name: "path", Type: bead.TypeString, Required: true, Description: "Policy file, directory, glob or bundle tarball."},
+		{Name: "data", Type: bead.TypeString, Description: "JSON or YAML data file, directory or glob loaded into the policy store."},
+		{Name: "package", Type: bead.TypeString, Default: "data.terraform.allow", Description: "Query to evaluate."},
+		{Name: "enforcement", Type: bead.TypeString, Default: EnforcementBlock, Description: "What a denial does: block, warn or audit."},
+	}
+}
+
+func (Handler) Validate(b bead.Bead) error {
+	switch enforcement(b) {
+	case EnforcementBlock, EnforcementWarn, EnforcementAudit:
+	default:
+		return &bead.FieldError{Field: "enforcement", Msg: fmt.Sprintf("opa bead %s has unknown enforcement %q, expected %s, %s or %s", b.Name, b.Fields["enforcement"], EnforcementBlock, EnforcementWarn, EnforcementAudit)}
+	}
+	return nil
+}
+
+// Plan evaluates the policy. A relayed OPA bead runs between the plan and
+// apply phases of its origin and fails when the input is blocked, so the
+// origin's saved plan is only applied when the policy allows it.
+func (Handler) Plan(ctx *bead.Context, b bead.Bead) error {
+	ctx.Log().Info("Processing OPA validation")
+	return evaluate(ctx, b)
+}
+
+func (Handler) Apply(ctx *bead.Context, b bead.Bead) error {
+	return nil
+}
+
+func (Handler) Outputs(ctx *bead.Context, b bead.Bead) (map[string]interface{}, error) {
+	return nil, nil
+}
+
+func evaluate(ctx *bead.Context, b bead.Bead) error {
+	err := HandleOPA(ctx, b)
+	if err != nil {
+		return fmt.Errorf("failed to process OPA: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package opa
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/janpreet/kado/packages/bead"
+	"github.com/open-policy-agent/opa/loader"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/storage/inmem"
+)
+
+// resolvePath returns where a path field of the bead points in the
+// LandingZone. Paths of a relayed bead are relative to the origin's clone.
+func resolvePath(ctx *bead.Context, path string) string {
+	if ctx.Origin != "" {
+		return filepath.Join(ctx.LandingZone, ctx.Origin, strings.TrimPrefix(path, ctx.Origin+"/"))
+	}
+	return filepath.Join(ctx.LandingZone, path)
+}
+
+// expand resolves a path field and expands it as a glob.
+func expand(ctx *bead.Context, field, path string) ([]string, error) {
+	pattern := resolvePath(ctx, path)
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s pattern %q: %v", field, path, err)
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no files match %s %q", field, pattern)
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+func isBundle(path string) bool {
+	return strings.HasSuffix(path, ".tar.gz") || strings.HasSuffix(path, ".tgz")
+}
+
+// policySet holds what an OPA bead loads: rego modules by file name, bundle
+// tarballs and data documents.
+type policySet struct {
+	modules map[string]*loader.RegoFile
+	bundles []string
+	data    map[string]interface{}
+}
+
+// loadPolicies loads the bead's policies and data. `path` is a .rego file, a
+// directory searched recursively for .rego files, a glob, or a bundle
+// tarball. `data` is a JSON or YAML file, directory or glob whose documents
+// are loaded into the store. With tests set, the _test.rego files next to
+// every policy file are loaded as well.
+func loadPolicies(ctx *bead.Context, b bead.Bead, tests bool) (*policySet, error) {
+	policyPath, ok := b.Fields["path"]
+	if !ok {
+		return nil, fmt.Errorf("policy path not specified in bead")
+	}
+	matches, err := expand(ctx, "path", policyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	set := &policySet{modules: map[string]*loader.RegoFile{}}
+	var regoPaths []string
+	for _, m := range matches {
+		if isBundle(m) {
+			set.bundles = append(set.bundles, m)
+			continue
+		}
+		regoPaths = append(regoPaths, m)
+		if tests && filepath.Ext(m) == ".rego" {
+			siblings, err := filepath.Glob(filepath.Join(filepath.Dir(m), "*_test.rego"))
+			if err != nil {
+				return nil, err
+			}
+			regoPaths = append(regoPaths, siblings...)
+		}
+	}
+	sort.Strings(regoPaths)
+	regoPaths = slices.Compact(regoPaths)
+
+	if len(regoPaths) > 0 {
+		result, err := loader.AllRegos(regoPaths)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load policies: %v", err)
+		}
+		if len(result.Modules) == 0 && len(set.bundles) == 0 {
+			return nil, fmt.Errorf("no .rego files found in %s", policyPath)
+		}
+		set.modules = result.Modules
+	}
+
+	if dataPath, ok := b.Fields["data"]; ok && dataPath != "" {
+		matches, err := expand(ctx, "data", dataPath)
+		if err != nil {
+			return nil, err
+		}
+		result, err := loader.NewFileLoader().Filtered(matches, func(_ string, info fs.FileInfo, _ int) bool {
+			if info.IsDir() {
+				return false
+			}
+			switch filepath.Ext(info.Name()) {
+			case ".json", ".yaml", ".yml":
+				return false
+			}
+			return true
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to load data: %v", err)
+		}
+		set.data = result.Documents
+	}
+
+	return set, nil
+}
+
+// moduleNames returns the names of the loaded modules in order.
+func (p *policySet) moduleNames() []string {
+	names := make([]string, 0, len(p.modules))
+	for name := range p.modules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// options returns the rego options that load the policy set for evaluation.
+func (p *policySet) options(ctx *bead.Context) []func(*rego.Rego) {
+	var options []func(*rego.Rego)
+	for _, path := range p.bundles {
+		ctx.Log().Debug("Loading policy bundle", "path", path)
+		options = append(options, rego.LoadBundle(path))
+	}
+	for _, name := range p.moduleNames() {
+		ctx.Log().Debug("Loading policy", "path", name)
+		options = append(options, rego.Module(name, string(p.modules[name].Raw)))
+	}
+	if p.data != nil {
+		options = append(options, rego.Store(inmem.NewFromObject(p.data)))
+	}
+	return options
+}
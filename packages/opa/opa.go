@@ -1,42 +1,43 @@
 package opa
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
-	"os"
-	"path/filepath"
-	"strings"
 	"github.com/janpreet/kado/packages/bead"
-	"github.com/janpreet/kado/packages/engine"
 	"github.com/janpreet/kado/packages/terraform"
 	"github.com/open-policy-agent/opa/rego"
 	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
 )
 
-func HandleOPA(b bead.Bead, landingZone string, applyPlan bool, originBead string) error {
-    fmt.Printf("Processing OPA bead (Origin: %s):\n", originBead)
-    for key, val := range b.Fields {
-        fmt.Printf("  %s = %s\n", key, val)
-    }
+// inputPath returns the document the bead evaluates. A gate relayed from a
+// terraform or terragrunt bead evaluates the JSON of the plan its origin
+// saved, unless the input field names another file.
+func inputPath(ctx *bead.Context, b bead.Bead) (string, error) {
+	if path := b.Fields["input"]; path != "" {
+		return resolvePath(ctx, path), nil
+	}
+	if plan, ok := ctx.Inputs[terraform.PlanJSONOutput].(string); ok && ctx.Origin != "" && plan != "" {
+		return plan, nil
+	}
+	return "", fmt.Errorf("input path not specified in bead")
+}
+
+func HandleOPA(ctx *bead.Context, b bead.Bead) error {
+	applyPlan := ctx.Apply
+	originBead := ctx.Origin
+	ctx.Log().Debug("Processing OPA bead", "origin", originBead, "fields", b.LogFields())
 
-    inputPath, ok := b.Fields["input"]
-    if !ok {
-        return fmt.Errorf("input path not specified in bead")
-    }
-    
-    fullInputPath := filepath.Join(landingZone, inputPath)
-    if originBead != "" {
-        
-        inputPath = strings.TrimPrefix(inputPath, originBead+"/")
-        fullInputPath = filepath.Join(landingZone, originBead, inputPath)
-    }
-    
-    fmt.Printf("Reading input file from path: %s\n", fullInputPath)
-    inputData, err := os.ReadFile(fullInputPath)
-    if err != nil {
-        return fmt.Errorf("failed to read input file: %v", err)
-    }
+	fullInputPath, err := inputPath(ctx, b)
+	if err != nil {
+		return err
+	}
+	ctx.Log().Debug("Reading input file", "path", fullInputPath)
+	inputData, err := os.ReadFile(fullInputPath)
+	if err != nil {
+		return fmt.Errorf("failed to read input file: %v", err)
+	}
 
 	var input interface{}
 	if filepath.Ext(fullInputPath) == ".yaml" || filepath.Ext(fullInputPath) == ".yml" {
@@ -49,35 +50,18 @@ func HandleOPA(b bead.Bead, landingZone string, applyPlan bool, originBead strin
 		}
 	}
 
-    policyPath, ok := b.Fields["path"]
-    if !ok {
-        return fmt.Errorf("policy path not specified in bead")
-    }
-    
-    fullPolicyPath := filepath.Join(landingZone, policyPath)
-    if originBead != "" {
-        
-        policyPath = strings.TrimPrefix(policyPath, originBead+"/")
-        fullPolicyPath = filepath.Join(landingZone, originBead, policyPath)
-    }
-    
-    fmt.Printf("Reading policy file from path: %s\n", fullPolicyPath)
-    policyData, err := os.ReadFile(fullPolicyPath)
-    if err != nil {
-        return fmt.Errorf("failed to read policy file: %v", err)
-    }
+	policies, err := loadPolicies(ctx, b, false)
+	if err != nil {
+		return err
+	}
 
 	packageQuery := "data.terraform.allow"
 	if pkg, ok := b.Fields["package"]; ok {
 		packageQuery = pkg
 	}
-	fmt.Printf("Evaluating package: %s\n", packageQuery)
+	ctx.Log().Info("Evaluating policy", "query", packageQuery)
 
-	ctx := context.Background()
-	query, err := rego.New(
-		rego.Query(packageQuery),
-		rego.Module("policy.rego", string(policyData)),
-	).PrepareForEval(ctx)
+	query, err := rego.New(append(policies.options(ctx), rego.Query(packageQuery))...).PrepareForEval(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to prepare rego query: %v", err)
 	}
@@ -87,64 +71,34 @@ func HandleOPA(b bead.Bead, landingZone string, applyPlan bool, originBead strin
 		return fmt.Errorf("failed to evaluate rego query: %v", err)
 	}
 
-	if len(results) == 0 || len(results[0].Expressions) == 0 || results[0].Expressions[0].Value != true {
-		fmt.Println("Input is denied by OPA policy.")
-		if applyPlan {
-			fmt.Println("Skipping action because the input was denied.")
-		}
-	} else {
-		fmt.Println("Input is allowed by OPA policy.")
-		if applyPlan {
-			switch originBead {
-			case "terraform":
-				fmt.Println("Applying terraform plan...")
-				err = terraform.HandleTerraform(b, landingZone, true)
-				if err != nil {
-					return fmt.Errorf("failed to apply terraform plan: %v", err)
-				}
-			case "ansible":
-				fmt.Println("Applying ansible playbook...")
-				err = handleAnsibleRelay(b, landingZone)
-				if err != nil {
-					return fmt.Errorf("failed to run Ansible: %v", err)
-				}
-			default:
-				fmt.Println("Skipping apply action because origin bead is not terraform or ansible.")
-			}
-		} else {
-			fmt.Println("Skipping apply action because 'set' was not passed.")
-		}
+	var value interface{}
+	if len(results) > 0 && len(results[0].Expressions) > 0 {
+		value = results[0].Expressions[0].Value
 	}
-
-	return nil
-}
-
-func convertYAMLToSlice(yamlData map[string]interface{}) []map[string]interface{} {
-	result := []map[string]interface{}{yamlData}
-	return result
-}
-
-func handleAnsibleRelay(b bead.Bead, landingZone string) error {
-
-	yamlPath := filepath.Join(landingZone, "ansible", "cluster.yaml")
-	yamlData, err := os.ReadFile(yamlPath)
+	decision, err := decide(packageQuery, value)
 	if err != nil {
-		return fmt.Errorf("failed to read YAML config: %v", err)
-	}
-
-	var yamlContent map[string]interface{}
-	if err := yaml.Unmarshal(yamlData, &yamlContent); err != nil {
-		return fmt.Errorf("failed to unmarshal YAML config: %v", err)
+		return err
 	}
-
-	extraVarsFile := false
-	if extraVarsFileFlag, ok := b.Fields["extra_vars_file"]; ok && extraVarsFileFlag == "true" {
-		extraVarsFile = true
+	decision.Enforcement = enforcement(b)
+	ctx.Result.SetDecision(decision)
+	if decision.Enforcement != EnforcementAudit {
+		printDecision(ctx, decision)
 	}
-
-	err = engine.HandleAnsible(b, convertYAMLToSlice(yamlContent), extraVarsFile)
-	if err != nil {
-		return fmt.Errorf("failed to run Ansible: %v", err)
+	ctx.Log().Info("Policy decision", "query", packageQuery, "allowed", decision.Allowed, "enforcement", decision.Enforcement)
+
+	if !decision.Allowed {
+		switch decision.Enforcement {
+		case EnforcementWarn:
+			ctx.Log().Warn("Input is denied by OPA policy, continuing because enforcement is warn", "failures", len(decision.Failures), "warnings", len(decision.Warnings))
+		case EnforcementAudit:
+			ctx.Log().Info("Input is denied by OPA policy, recorded for audit", "failures", len(decision.Failures))
+		default:
+			ctx.Log().Warn("Input is denied by OPA policy", "failures", len(decision.Failures), "warnings", len(decision.Warnings))
+			if applyPlan && ctx.Origin != "" {
+				ctx.Log().Warn("Not applying the plan because the input was denied", "origin", ctx.Origin)
+			}
+			return denial(decision)
+		}
 	}
 
 	return nil
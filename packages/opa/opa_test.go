@@ -1,11 +1,256 @@
 package opa
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/janpreet/kado/packages/bead"
+	"github.com/janpreet/kado/packages/report"
+	"github.com/janpreet/kado/packages/terraform"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-func TestOPAPlaceholder(t *testing.T) {
-	assert.True(t, true)
+const policy = `package main
+
+import rego.v1
+
+deny contains msg if {
+	input.public
+	msg := "vm is public"
+}
+
+violation_size contains {"msg": sprintf("vm has %d cores", [input.cores])} if {
+	input.cores > 8
+}
+
+warn_tags contains "vm has no tags" if {
+	count(object.get(input, "tags", [])) == 0
+}
+
+allow if count(deny) == 0
+`
+
+func TestDecide(t *testing.T) {
+	d, err := decide("data.terraform.allow", true)
+	require.NoError(t, err)
+	assert.True(t, d.Allowed)
+
+	d, err = decide("data.terraform.allow", nil)
+	require.NoError(t, err)
+	assert.False(t, d.Allowed)
+
+	d, err = decide("data.main.warn", []interface{}{"no tags"})
+	require.NoError(t, err)
+	assert.True(t, d.Allowed)
+	assert.Equal(t, []report.Message{{Rule: "warn", Msg: "no tags"}}, d.Warnings)
+
+	_, err = decide("data.main.count", 3)
+	assert.Error(t, err)
+}
+
+func evalPolicy(t *testing.T, input, query string) (*report.Bead, string, error) {
+	return evalPolicyWith(t, input, map[string]string{"package": query})
+}
+
+func evalPolicyWith(t *testing.T, input string, fields map[string]string) (*report.Bead, string, error) {
+	lz := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(lz, "policy.rego"), []byte(policy), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(lz, "input.json"), []byte(input), 0644))
+
+	var out bytes.Buffer
+	result := &report.Bead{}
+	ctx := &bead.Context{Context: context.Background(), LandingZone: lz, Stdout: &out, Result: result}
+	b := bead.Bead{Name: "policy", Fields: map[string]string{"path": "policy.rego", "input": "input.json"}}
+	for k, v := range fields {
+		b.Fields[k] = v
+	}
+	err := HandleOPA(ctx, b)
+	return result, out.String(), err
+}
+
+func TestHandleOPADeny(t *testing.T) {
+	result, out, err := evalPolicy(t, `{"public": true, "cores": 16}`, "data.main")
+	assert.EqualError(t, err, "input denied by policy data.main: deny: vm is public; violation_size: vm has 16 cores")
+	assert.Contains(t, out, "FAIL - data.main - deny - vm is public\n")
+	assert.Contains(t, out, "FAIL - data.main - violation_size - vm has 16 cores\n")
+	assert.Contains(t, out, "WARN - data.main - warn_tags - vm has no tags\n")
+	assert.Contains(t, out, "2 failure(s), 1 warning(s)\n")
+	require.NotNil(t, result.Decision)
+	assert.False(t, result.Decision.Allowed)
+	assert.Equal(t, EnforcementBlock, result.Decision.Enforcement)
+	assert.Len(t, result.Decision.Failures, 2)
+}
+
+func TestHandleOPAEnforcement(t *testing.T) {
+	result, out, err := evalPolicyWith(t, `{"public": true, "cores": 2}`, map[string]string{"package": "data.main", "enforcement": "warn"})
+	require.NoError(t, err)
+	assert.Contains(t, out, "FAIL - data.main - deny - vm is public\n")
+	assert.False(t, result.Decision.Allowed)
+	assert.Equal(t, EnforcementWarn, result.Decision.Enforcement)
+
+	result, out, err = evalPolicyWith(t, `{"public": true, "cores": 2}`, map[string]string{"package": "data.main", "enforcement": "audit"})
+	require.NoError(t, err)
+	assert.Empty(t, out)
+	assert.False(t, result.Decision.Allowed)
+	assert.Equal(t, []report.Message{{Rule: "deny", Msg: "vm is public"}}, result.Decision.Failures)
+
+	b := bead.Bead{Name: "policy", Fields: map[string]string{"path": "p.rego", "input": "i.json", "enforcement": "strict"}}
+	assert.EqualError(t, Handler{}.Validate(b), `opa bead policy has unknown enforcement "strict", expected block, warn or audit`)
+}
+
+func TestHandleOPAAllow(t *testing.T) {
+	result, out, err := evalPolicy(t, `{"public": false, "cores": 2, "tags": ["web"]}`, "data.main")
+	require.NoError(t, err)
+	assert.Empty(t, out)
+	assert.True(t, result.Decision.Allowed)
+
+	_, _, err = evalPolicy(t, `{"public": true, "cores": 2}`, "data.main.allow")
+	assert.EqualError(t, err, "input denied by policy data.main.allow")
+}
+
+func TestHandleOPAPlanInput(t *testing.T) {
+	lz := t.TempDir()
+	writeFiles(t, lz, map[string]string{
+		"network/policy.rego":       policy,
+		"network/plan.json":         `{"public": true, "cores": 2}`,
+		"network/policy/input.json": `{"public": false, "cores": 2, "tags": ["web"]}`,
+	})
+
+	ctx := &bead.Context{
+		Context:     context.Background(),
+		LandingZone: lz,
+		Origin:      "network",
+		Inputs:      map[string]interface{}{terraform.PlanJSONOutput: filepath.Join(lz, "network", "plan.json")},
+		Stdout:      &bytes.Buffer{},
+		Result:      &report.Bead{},
+	}
+	b := bead.Bead{Name: "policy", Fields: map[string]string{"path": "policy.rego", "package": "data.main.allow"}}
+	assert.EqualError(t, HandleOPA(ctx, b), "input denied by policy data.main.allow")
+
+	b.Fields["input"] = "policy/input.json"
+	assert.NoError(t, HandleOPA(ctx, b))
+
+	ctx.Origin, ctx.Inputs = "", nil
+	delete(b.Fields, "input")
+	assert.EqualError(t, HandleOPA(ctx, b), "input path not specified in bead")
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+}
+
+const limitsPolicy = `package main
+
+import rego.v1
+
+import data.lib.limits
+
+deny contains msg if {
+	input.cores > limits.max_cores(data.sizes)
+	msg := sprintf("vm has more than %d cores", [limits.max_cores(data.sizes)])
+}
+`
+
+const limitsLib = `package lib.limits
+
+max_cores(sizes) := sizes.large.cores
+`
+
+func TestLoadPolicyDirectoryAndData(t *testing.T) {
+	lz := t.TempDir()
+	writeFiles(t, lz, map[string]string{
+		"policies/main.rego":       limitsPolicy,
+		"policies/lib/limits.rego": limitsLib,
+		"policies/README.md":       "not a policy",
+		"data/sizes.yaml":          "sizes:\n  large:\n    cores: 8\n",
+		"input.json":               `{"cores": 16}`,
+	})
+
+	eval := func(path string) error {
+		ctx := &bead.Context{Context: context.Background(), LandingZone: lz, Stdout: &bytes.Buffer{}}
+		return HandleOPA(ctx, bead.Bead{Name: "policy", Fields: map[string]string{
+			"path": path, "data": "data/*.yaml", "input": "input.json", "package": "data.main",
+		}})
+	}
+
+	for _, path := range []string{"policies", "policies/*"} {
+		assert.EqualError(t, eval(path), "input denied by policy data.main: deny: vm has more than 8 cores", path)
+	}
+	// Without the directory, the helper package the policy imports is missing.
+	assert.ErrorContains(t, eval("policies/*.rego"), "failed to prepare rego query")
+}
+
+func TestLoadPolicyBundle(t *testing.T) {
+	lz := t.TempDir()
+	writeFiles(t, lz, map[string]string{"input.json": `{"cores": 16}`})
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range map[string]string{
+		"/main.rego":       limitsPolicy,
+		"/lib/limits.rego": limitsLib,
+		"/data.json":       `{"sizes": {"large": {"cores": 32}}}`,
+	} {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	require.NoError(t, os.WriteFile(filepath.Join(lz, "policy.tar.gz"), buf.Bytes(), 0644))
+
+	ctx := &bead.Context{Context: context.Background(), LandingZone: lz, Stdout: &bytes.Buffer{}}
+	b := bead.Bead{Name: "policy", Fields: map[string]string{"path": "policy.tar.gz", "input": "input.json", "package": "data.main"}}
+	assert.NoError(t, HandleOPA(ctx, b))
+}
+
+func TestLoadPolicyMissing(t *testing.T) {
+	ctx := &bead.Context{Context: context.Background(), LandingZone: t.TempDir()}
+	_, err := loadPolicies(ctx, bead.Bead{Fields: map[string]string{"path": "policies/*.rego"}}, false)
+	assert.ErrorContains(t, err, "no files match path")
+}
+
+func TestRunTests(t *testing.T) {
+	lz := t.TempDir()
+	writeFiles(t, lz, map[string]string{
+		"policies/main.rego":       limitsPolicy,
+		"policies/lib/limits.rego": limitsLib,
+		"policies/main_test.rego": `package main
+
+import rego.v1
+
+test_large_vm_denied if {
+	count(deny) == 1 with input as {"cores": 16} with data.sizes as {"large": {"cores": 8}}
+}
+
+test_small_vm_denied if {
+	count(deny) == 1 with input as {"cores": 2} with data.sizes as {"large": {"cores": 8}}
+}
+`,
+	})
+
+	var out bytes.Buffer
+	ctx := &bead.Context{Context: context.Background(), LandingZone: lz, Stdout: &out}
+	summary, err := RunTests(ctx, bead.Bead{Name: "policy", Fields: map[string]string{"path": "policies"}})
+	assert.EqualError(t, err, "1 policy test(s) failed: data.main.test_small_vm_denied")
+	assert.Equal(t, 1, summary.Passed)
+	assert.Equal(t, 1, summary.Failed)
+	assert.Greater(t, summary.Coverage, 50.0)
+	assert.Contains(t, out.String(), "FAIL data.main.test_small_vm_denied")
+
+	// A single policy file brings the tests next to it along, but not the
+	// helper package it imports.
+	_, err = RunTests(ctx, bead.Bead{Name: "policy", Fields: map[string]string{"path": "policies/main.rego"}})
+	assert.ErrorContains(t, err, "failed to run policy tests")
 }
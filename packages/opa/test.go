@@ -0,0 +1,108 @@
+package opa
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/janpreet/kado/packages/bead"
+	"github.com/janpreet/kado/packages/report"
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/bundle"
+	"github.com/open-policy-agent/opa/cover"
+	"github.com/open-policy-agent/opa/loader"
+	"github.com/open-policy-agent/opa/storage"
+	"github.com/open-policy-agent/opa/storage/inmem"
+	"github.com/open-policy-agent/opa/tester"
+)
+
+// RunTests runs the rego unit tests found with the policies of an OPA bead,
+// i.e. the test_ rules of the _test.rego files loaded with them. Each
+// failing test is printed to the bead's output, followed by a summary. The
+// returned error reports failing tests, or tests that could not be run.
+func RunTests(ctx *bead.Context, b bead.Bead) (report.TestSummary, error) {
+	var summary report.TestSummary
+	policies, err := loadPolicies(ctx, b, true)
+	if err != nil {
+		return summary, err
+	}
+
+	modules := make(map[string]*ast.Module, len(policies.modules))
+	for name, f := range policies.modules {
+		modules[name] = f.Parsed
+	}
+	bundles := make(map[string]*bundle.Bundle, len(policies.bundles))
+	for _, path := range policies.bundles {
+		bndl, err := loader.NewFileLoader().AsBundle(path)
+		if err != nil {
+			return summary, fmt.Errorf("failed to load bundle %s: %v", path, err)
+		}
+		bundles[path] = bndl
+	}
+
+	data := policies.data
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	store := inmem.NewFromObject(data)
+	txn, err := store.NewTransaction(ctx, storage.WriteParams)
+	if err != nil {
+		return summary, fmt.Errorf("failed to open policy store: %v", err)
+	}
+	defer store.Abort(ctx, txn)
+
+	coverage := cover.New()
+	ch, err := tester.NewRunner().
+		SetStore(store).
+		SetModules(modules).
+		SetBundles(bundles).
+		SetCoverageQueryTracer(coverage).
+		RunTests(ctx, txn)
+	if err != nil {
+		return summary, fmt.Errorf("failed to run policy tests: %v", err)
+	}
+
+	var w io.Writer = os.Stdout
+	if ctx.Stdout != nil {
+		w = ctx.Stdout
+	}
+	var failed []string
+	for result := range ch {
+		switch {
+		case result.Skip:
+			summary.Skipped++
+		case result.Error != nil:
+			summary.Failed++
+			failed = append(failed, result.Package+"."+result.Name)
+			fmt.Fprintf(w, "ERROR %s.%s: %v\n", result.Package, result.Name, result.Error)
+		case result.Fail:
+			summary.Failed++
+			failed = append(failed, result.Package+"."+result.Name)
+			fmt.Fprintf(w, "FAIL %s.%s (%s)\n", result.Package, result.Name, result.Location)
+		default:
+			summary.Passed++
+		}
+	}
+
+	covered := make(map[string]*ast.Module)
+	for name, module := range modules {
+		if !strings.HasSuffix(name, "_test.rego") {
+			covered[name] = module
+		}
+	}
+	for path, bndl := range bundles {
+		for name, module := range bndl.ParsedModules(path) {
+			if !strings.HasSuffix(name, "_test.rego") {
+				covered[name] = module
+			}
+		}
+	}
+	summary.Coverage = coverage.Report(covered).Coverage
+
+	fmt.Fprintf(w, "%s\n", summary)
+	if len(failed) > 0 {
+		return summary, fmt.Errorf("%d policy test(s) failed: %s", len(failed), strings.Join(failed, ", "))
+	}
+	return summary, nil
+}
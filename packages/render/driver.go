@@ -5,14 +5,19 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"text/template"
-	"regexp"
+	"text/template/parse"
+
+	"github.com/janpreet/kado/packages/bead"
 	"github.com/janpreet/kado/packages/config"
-	"github.com/janpreet/kado/packages/keybase"	
+	"github.com/janpreet/kado/packages/keybase"
 )
 
-var keybaseNoteRegex = regexp.MustCompile(`{{keybase:note:([^}]+)}}`)
+var keybaseNoteRegex = regexp.MustCompile(`{{\s*keybase:note:([^}\s]+)\s*}}`)
 
 func join(data map[string]interface{}, key, delimiter string) string {
 	var result []string
@@ -29,13 +34,20 @@ func join(data map[string]interface{}, key, delimiter string) string {
 
 type FlattenedDataMap struct {
 	Data map[string]interface{}
+	// Strict makes Get fail on keys the data file does not set.
+	Strict bool
 }
 
-func (f FlattenedDataMap) Get(key string) interface{} {
+// Get returns the value of a flattened key such as "proxmox.vm.cpu". A key
+// the data file does not set is empty, or an error in strict mode.
+func (f FlattenedDataMap) Get(key string) (interface{}, error) {
 	if val, ok := f.Data[key]; ok {
-		return val
+		return val, nil
+	}
+	if f.Strict {
+		return nil, fmt.Errorf("key %q is not set in the data file", key)
 	}
-	return "<no value>"
+	return "", nil
 }
 
 func (f FlattenedDataMap) Env(key string) string {
@@ -82,85 +94,358 @@ func contains(slice []string, item string) bool {
 	return false
 }
 
-func ProcessTemplate(templatePath string, data map[string]interface{}) (string, error) {
+// templateData is what templates are executed with: the helpers of
+// FlattenedDataMap, which read the flattened data file, and, as .Data, the
+// data file as it was parsed, so that templates can range over and index
+// nested values.
+type templateData struct {
+	Data map[string]interface{}
+
+	flatData FlattenedDataMap
+}
+
+func (d templateData) Get(key string) (interface{}, error) {
+	return d.flatData.Get(key)
+}
+
+func (d templateData) Env(key string) string {
+	return d.flatData.Env(key)
+}
+
+func (d templateData) GetKeysAsArray(key string) string {
+	return d.flatData.GetKeysAsArray(key)
+}
+
+// StrictTemplates reports whether the data file sets kado.strict_templates,
+// which makes a key missing from the data file an error when rendering.
+func StrictTemplates(yamlData map[string]interface{}) bool {
+	kado, ok := yamlData["kado"].(map[string]interface{})
+	if !ok {
+		return false
+	}
+	strict, _ := kado["strict_templates"].(bool)
+	return strict
+}
+
+// Values is what templates are rendered with.
+type Values struct {
+	// Data is the parsed data file, e.g. cluster.yaml.
+	Data map[string]interface{}
+	// Outputs holds the outputs of the beads processed so far, by bead name.
+	// Templates read them with {{ Output "bead" "name" }}.
+	Outputs map[string]map[string]interface{}
+	// Inputs holds the outputs the bead that relayed to the rendering bead
+	// passed on. Templates read them with {{ Input "name" }}.
+	Inputs map[string]interface{}
+}
+
+// output looks up an output of a processed bead. It is nil until the bead
+// has run and produced the output, so that templates rendered for earlier
+// beads, or in plan mode before anything was applied, still render. In
+// strict mode a missing output is an error.
+func (v Values) output(strict bool, beadName, name string) (interface{}, error) {
+	value, ok := v.Outputs[beadName][name]
+	if !ok && strict {
+		return nil, fmt.Errorf("output %q of bead %q is not set", name, beadName)
+	}
+	return value, nil
+}
+
+// input looks up an output the relaying bead passed on. It is nil for beads
+// that were not relayed to, or an error in strict mode.
+func (v Values) input(strict bool, name string) (interface{}, error) {
+	value, ok := v.Inputs[name]
+	if !ok && strict {
+		return nil, fmt.Errorf("input %q is not set", name)
+	}
+	return value, nil
+}
+
+// ProcessTemplate renders a template into the LandingZone and returns the
+// path written.
+func ProcessTemplate(templatePath string, values Values) (string, error) {
+	return renderTemplate(templatePath, config.LandingZone, values)
+}
+
+// renderTemplate renders a template into dir, under the file name given on
+// its first line.
+func renderTemplate(templatePath, dir string, values Values) (string, error) {
 	content, err := os.ReadFile(templatePath)
 	if err != nil {
 		return "", fmt.Errorf("failed to read template file: %v", err)
 	}
+	fileName, templateContent, err := parseHeader(templatePath, content)
+	if err != nil {
+		return "", err
+	}
 
-	lines := strings.Split(string(content), "\n")
-	var filteredLines []string
-	for _, line := range lines {
-		if strings.TrimSpace(line) == "" || strings.HasPrefix(strings.TrimSpace(line), "#") {
-			filteredLines = append(filteredLines, line)
-			continue
-		}
-		filteredLines = append(filteredLines, line)
+	flatData := FlattenedDataMap{Data: FlattenYAML("", values.Data), Strict: StrictTemplates(values.Data)}
+	tmpl, err := parseTemplate(templatePath, templateContent, values, flatData)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse template: %v", err)
+	}
+
+	var output bytes.Buffer
+	if err := tmpl.Execute(&output, templateData{Data: values.Data, flatData: flatData}); err != nil {
+		return "", fmt.Errorf("failed to execute template: %v", err)
 	}
 
-	firstLine, templateContent := filteredLines[0], strings.Join(filteredLines[1:], "\n")
-	if !strings.HasPrefix(firstLine, "<") || !strings.HasSuffix(firstLine, ">") {
-		return "", fmt.Errorf("invalid file name format in template: %s", firstLine)
+	outputPath := filepath.Join(dir, fileName)
+	err = WriteToFile(outputPath, output.Bytes())
+	if err != nil {
+		return "", fmt.Errorf("failed to write output file: %v", err)
 	}
-	fileName := strings.Trim(firstLine, "<>")
 
-	flatData := FlattenYAML("", data)
+	return outputPath, nil
+}
+
+// TemplateError is a problem with a template file, at a 1-based line.
+type TemplateError struct {
+	Path string
+	Line int
+	Msg  string
+}
+
+func (e *TemplateError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.Path, e.Line, e.Msg)
+}
+
+// parseHeader splits a template into the name of the file it renders to,
+// written as <name> on its first line, and the template body.
+func parseHeader(templatePath string, content []byte) (string, string, error) {
+	firstLine, templateContent, _ := strings.Cut(string(content), "\n")
+	if strings.TrimSpace(firstLine) == "" {
+		return "", "", &TemplateError{Path: templatePath, Line: 1, Msg: "missing file name header, expected <file name> on the first line"}
+	}
+	if !strings.HasPrefix(firstLine, "<") || !strings.HasSuffix(firstLine, ">") || len(firstLine) < 3 {
+		return "", "", &TemplateError{Path: templatePath, Line: 1, Msg: fmt.Sprintf("invalid file name format in template: %s", firstLine)}
+	}
+	return strings.Trim(firstLine, "<>"), templateContent, nil
+}
+
+// templateLineRegex matches the line text/template reports parse errors at.
+var templateLineRegex = regexp.MustCompile(`^template: [^:]*:(\d+):\s*`)
+
+// CheckTemplate checks that a template has a file name header and parses,
+// without rendering it. Problems are returned as a *TemplateError.
+func CheckTemplate(templatePath string) error {
+	content, err := os.ReadFile(templatePath)
+	if err != nil {
+		return &TemplateError{Path: templatePath, Line: 1, Msg: fmt.Sprintf("failed to read template file: %v", err)}
+	}
+	_, templateContent, err := parseHeader(templatePath, content)
+	if err != nil {
+		return err
+	}
+	if _, err := parseTemplate(templatePath, templateContent, Values{}, FlattenedDataMap{}); err != nil {
+		msg := err.Error()
+		line := 1
+		if m := templateLineRegex.FindStringSubmatch(msg); m != nil {
+			// The body starts on the line after the header.
+			n, _ := strconv.Atoi(m[1])
+			line = n + 1
+			msg = msg[len(m[0]):]
+		}
+		return &TemplateError{Path: templatePath, Line: line, Msg: msg}
+	}
+	return nil
+}
 
+// parseTemplate parses a template body with the template functions bound
+// to values and the flattened data. In strict mode a missing map key of
+// .Data is an error too.
+func parseTemplate(templatePath, templateContent string, values Values, flatData FlattenedDataMap) (*template.Template, error) {
 	funcMap := template.FuncMap{
 		"join": func(key, delimiter string) string {
-			return join(flatData, key, delimiter)
+			return join(flatData.Data, key, delimiter)
 		},
-		"Get": func(key string) interface{} {
-			return FlattenedDataMap{Data: flatData}.Get(key)
+		"Get":            flatData.Get,
+		"Env":            flatData.Env,
+		"GetKeysAsArray": flatData.GetKeysAsArray,
+		"KeybaseNote": func(noteName string) (string, error) {
+			return resolveKeybaseNote(noteName)
 		},
-		"Env": func(key string) string {
-			return FlattenedDataMap{Data: flatData}.Env(key)
+		"Output": func(beadName, name string) (interface{}, error) {
+			return values.output(flatData.Strict, beadName, name)
 		},
-		"GetKeysAsArray": func(key string) string {
-			return FlattenedDataMap{Data: flatData}.GetKeysAsArray(key)
+		"Input": func(name string) (interface{}, error) {
+			return values.input(flatData.Strict, name)
 		},
-        "KeybaseNote": func(noteName string) (string, error) {
-            return resolveKeybaseNote(noteName)
-        },		
+		missingValueFunc: missingValue,
 	}
 
 	processedContent := keybaseNoteRegex.ReplaceAllStringFunc(templateContent, func(match string) string {
-        noteName := strings.TrimPrefix(strings.TrimSuffix(match, "}}"), "{{keybase:note:")
-        return fmt.Sprintf(`{{ KeybaseNote "%s" }}`, noteName)
-    })	
+		noteName := keybaseNoteRegex.FindStringSubmatch(match)[1]
+		return fmt.Sprintf(`{{ KeybaseNote "%s" }}`, noteName)
+	})
 
-    tmpl, err := template.New(filepath.Base(templatePath)).Funcs(funcMap).Parse(processedContent)
-    if err != nil {
-        return "", fmt.Errorf("failed to parse template: %v", err)
-    }
+	tmpl := template.New(filepath.Base(templatePath)).Funcs(funcs).Funcs(funcMap)
+	if flatData.Strict {
+		tmpl = tmpl.Option("missingkey=error")
+	}
+	tmpl, err := tmpl.Parse(processedContent)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			printMissingAsEmpty(t.Tree.Root)
+		}
+	}
+	return tmpl, nil
+}
 
-	var output bytes.Buffer
-	if err := tmpl.Execute(&output, FlattenedDataMap{Data: flatData}); err != nil {
-		return "", fmt.Errorf("failed to execute template: %v", err)
+// missingValueFunc is piped into every action that prints a value.
+const missingValueFunc = "kadoValue"
+
+// printMissingAsEmpty makes the actions under node print a missing value,
+// such as a key .Data does not have or an output not produced yet, as empty
+// text instead of "<no value>". text/template prints "<no value>" for the
+// missing keys of a map[string]interface{} whatever the missingkey option,
+// so the value each action prints is piped through missingValueFunc.
+func printMissingAsEmpty(node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			printMissingAsEmpty(child)
+		}
+	case *parse.ActionNode:
+		if len(n.Pipe.Decl) > 0 {
+			return
+		}
+		ident := parse.NewIdentifier(missingValueFunc).SetPos(n.Pos)
+		n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{NodeType: parse.NodeCommand, Pos: n.Pos, Args: []parse.Node{ident}})
+	case *parse.IfNode:
+		printMissingAsEmpty(n.List)
+		printMissingAsEmpty(n.ElseList)
+	case *parse.RangeNode:
+		printMissingAsEmpty(n.List)
+		printMissingAsEmpty(n.ElseList)
+	case *parse.WithNode:
+		printMissingAsEmpty(n.List)
+		printMissingAsEmpty(n.ElseList)
 	}
+}
 
-	outputPath := filepath.Join(config.LandingZone, fileName)
-	err = WriteToFile(outputPath, output.Bytes())
-	if err != nil {
-		return "", fmt.Errorf("failed to write output file: %v", err)
+// missingValue returns value, or an empty string if it is missing.
+func missingValue(value interface{}) interface{} {
+	if value == nil {
+		return ""
 	}
+	return value
+}
 
-	return outputPath, nil
+// TemplatePaths returns the template list configured under kado.templates,
+// or every .tmpl file under config.TemplateDir when that is set.
+func TemplatePaths(yamlData map[string]interface{}) ([]string, bool) {
+	if config.TemplateDir != "" {
+		return templatesInDir(config.TemplateDir)
+	}
+	kado, ok := yamlData["kado"].(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	paths, ok := kado["templates"].([]interface{})
+	if !ok {
+		return nil, false
+	}
+	return convertPaths(paths), true
 }
 
-func ProcessTemplates(templatePaths []string, data map[string]interface{}) error {
-	for _, templatePath := range templatePaths {
-		if _, err := ProcessTemplate(templatePath, data); err != nil {
-			return fmt.Errorf("failed to process template %s: %v", templatePath, err)
+// Templates are the templates a bead renders and the directory the rendered
+// files are written to.
+type Templates struct {
+	Paths []string
+	Dir   string
+	// Own is set when the templates are the bead's own, from its templates
+	// field or its section of kado.templates, rather than the shared list.
+	Own bool
+}
+
+// BeadTemplates returns the templates of a bead. A bead's own templates are
+// rendered into its directory in landingZone, so that it only sees its own
+// files. Beads without their own templates render the shared kado.templates
+// list, or --templates, into landingZone itself.
+func BeadTemplates(landingZone string, yamlData map[string]interface{}, b bead.Bead) (Templates, bool) {
+	if paths := b.List("templates"); len(paths) > 0 {
+		return Templates{Paths: paths, Dir: filepath.Join(landingZone, b.Name), Own: true}, true
+	}
+	if kado, ok := yamlData["kado"].(map[string]interface{}); ok {
+		if sections, ok := kado["templates"].(map[string]interface{}); ok {
+			paths, ok := sections[b.Name].([]interface{})
+			if !ok {
+				return Templates{}, false
+			}
+			return Templates{Paths: convertPaths(paths), Dir: filepath.Join(landingZone, b.Name), Own: true}, true
 		}
 	}
-	return nil
+	paths, ok := TemplatePaths(yamlData)
+	return Templates{Paths: paths, Dir: landingZone}, ok
+}
+
+func convertPaths(paths []interface{}) []string {
+	var result []string
+	for _, path := range paths {
+		if strPath, ok := path.(string); ok {
+			result = append(result, strPath)
+		}
+	}
+	return result
+}
+
+func templatesInDir(dir string) ([]string, bool) {
+	var result []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && strings.HasSuffix(info.Name(), ".tmpl") {
+			result = append(result, path)
+		}
+		return nil
+	})
+	if err != nil || len(result) == 0 {
+		return nil, false
+	}
+	return result, true
+}
+
+// templatesMu serialises rendering into the shared LandingZone while beads
+// run in parallel.
+var templatesMu sync.Mutex
+
+// ProcessTemplates renders the templates and returns the paths written.
+func ProcessTemplates(templates Templates, values Values) ([]string, error) {
+	return RenderTemplates(templates, values, nil)
+}
+
+// RenderTemplates renders the templates and then calls consume, if set,
+// before any other bead can render again. Handlers that move rendered files
+// out of the LandingZone do so in consume. It returns the paths written.
+func RenderTemplates(templates Templates, values Values, consume func() error) ([]string, error) {
+	templatesMu.Lock()
+	defer templatesMu.Unlock()
+	var rendered []string
+	for _, templatePath := range templates.Paths {
+		outputPath, err := renderTemplate(templatePath, templates.Dir, values)
+		if err != nil {
+			return rendered, fmt.Errorf("failed to process template %s: %v", templatePath, err)
+		}
+		rendered = append(rendered, outputPath)
+	}
+	if consume != nil {
+		return rendered, consume()
+	}
+	return rendered, nil
 }
 
 func resolveKeybaseNote(noteName string) (string, error) {
-    content, err := keybase.ViewNote(noteName)
-    if err != nil {
-        return "", fmt.Errorf("failed to resolve Keybase note %s: %v", noteName, err)
-    }
-    return strings.TrimSpace(content), nil
-}
\ No newline at end of file
+	content, err := keybase.ViewNote(noteName)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve Keybase note %s: %v", noteName, err)
+	}
+	return strings.TrimSpace(content), nil
+}
@@ -0,0 +1,197 @@
+package render
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/janpreet/kado/packages/bead"
+	"github.com/janpreet/kado/packages/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessTemplateOutput(t *testing.T) {
+	dir := t.TempDir()
+	landingZone := config.LandingZone
+	config.LandingZone = dir
+	defer func() { config.LandingZone = landingZone }()
+
+	tmpl := filepath.Join(dir, "inventory.tmpl")
+	require.NoError(t, os.WriteFile(tmpl, []byte("<inventory.ini>\n[web]\n{{ range Output \"compute\" \"vm_ips\" }}{{ . }}\n{{ end }}"), 0644))
+
+	values := Values{
+		Data:    map[string]interface{}{},
+		Outputs: map[string]map[string]interface{}{"compute": {"vm_ips": []interface{}{"10.0.0.1", "10.0.0.2"}}},
+	}
+	path, err := ProcessTemplate(tmpl, values)
+	require.NoError(t, err)
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "[web]\n10.0.0.1\n10.0.0.2\n", string(content))
+
+	values.Outputs = nil
+	path, err = ProcessTemplate(tmpl, values)
+	require.NoError(t, err)
+	content, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "[web]\n", string(content))
+
+	require.NoError(t, os.WriteFile(tmpl, []byte("<inventory.ini>\n[web]\n{{ range Input \"vm_ips\" }}{{ . }}\n{{ end }}"), 0644))
+	values.Inputs = map[string]interface{}{"vm_ips": []interface{}{"10.0.0.3"}}
+	path, err = ProcessTemplate(tmpl, values)
+	require.NoError(t, err)
+	content, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "[web]\n10.0.0.3\n", string(content))
+}
+
+func TestBeadTemplates(t *testing.T) {
+	data := map[string]interface{}{
+		"kado": map[string]interface{}{
+			"templates": []interface{}{"templates/inventory.tmpl", "templates/vm.tfvars.tmpl"},
+		},
+	}
+	shared, ok := BeadTemplates("lz", data, bead.Bead{Name: "network"})
+	require.True(t, ok)
+	assert.Equal(t, Templates{Paths: []string{"templates/inventory.tmpl", "templates/vm.tfvars.tmpl"}, Dir: "lz"}, shared)
+
+	own, ok := BeadTemplates("lz", data, bead.Bead{Name: "network", Values: map[string]interface{}{"templates": []interface{}{"templates/vm.tfvars.tmpl"}}})
+	require.True(t, ok)
+	assert.Equal(t, Templates{Paths: []string{"templates/vm.tfvars.tmpl"}, Dir: filepath.Join("lz", "network"), Own: true}, own)
+
+	data["kado"] = map[string]interface{}{
+		"templates": map[string]interface{}{
+			"configure": []interface{}{"templates/inventory.tmpl"},
+		},
+	}
+	section, ok := BeadTemplates("lz", data, bead.Bead{Name: "configure"})
+	require.True(t, ok)
+	assert.Equal(t, Templates{Paths: []string{"templates/inventory.tmpl"}, Dir: filepath.Join("lz", "configure"), Own: true}, section)
+
+	_, ok = BeadTemplates("lz", data, bead.Bead{Name: "network"})
+	assert.False(t, ok)
+}
+
+func TestRenderTemplatesIntoBeadDir(t *testing.T) {
+	dir := t.TempDir()
+	tmpl := filepath.Join(dir, "vm.tfvars.tmpl")
+	require.NoError(t, os.WriteFile(tmpl, []byte("<vm.tfvars>\nname = \"{{ .Get \"vm.name\" }}\""), 0644))
+
+	templates := Templates{Paths: []string{tmpl}, Dir: filepath.Join(dir, "network"), Own: true}
+	values := Values{Data: map[string]interface{}{"vm": map[string]interface{}{"name": "web"}}}
+	rendered, err := ProcessTemplates(templates, values)
+	require.NoError(t, err)
+	require.Equal(t, []string{filepath.Join(dir, "network", "vm.tfvars")}, rendered)
+	content, err := os.ReadFile(rendered[0])
+	require.NoError(t, err)
+	assert.Equal(t, "name = \"web\"", string(content))
+}
+
+func TestProcessTemplateHeader(t *testing.T) {
+	dir := t.TempDir()
+	for content, want := range map[string]string{
+		"":                   "missing file name header",
+		"\n{{ .Get \"a\" }}": "missing file name header",
+		"out.txt\nbody":      "invalid file name format in template: out.txt",
+		"<>\nbody":           "invalid file name format in template: <>",
+	} {
+		tmpl := filepath.Join(dir, "t.tmpl")
+		require.NoError(t, os.WriteFile(tmpl, []byte(content), 0644))
+		_, err := renderTemplate(tmpl, dir, Values{})
+		require.Error(t, err, content)
+		assert.Contains(t, err.Error(), want)
+
+		var templateErr *TemplateError
+		require.ErrorAs(t, CheckTemplate(tmpl), &templateErr)
+		assert.Equal(t, 1, templateErr.Line)
+	}
+}
+
+func TestCheckTemplateKeybaseNote(t *testing.T) {
+	tmpl := filepath.Join(t.TempDir(), "t.tmpl")
+	require.NoError(t, os.WriteFile(tmpl, []byte("<out.txt>\nuser = \"{{ keybase:note:user }}\"\npass = \"{{keybase:note:pass}}\"\n"), 0644))
+	assert.NoError(t, CheckTemplate(tmpl))
+}
+
+func TestProcessTemplateData(t *testing.T) {
+	dir := t.TempDir()
+	tmpl := filepath.Join(dir, "vm.tfvars.tmpl")
+	body := `<vm.tfvars>
+{{ range .Data.vms }}{{ .name }} = {{ .cpu | default 2 }}
+{{ end }}first = {{ quote (index .Data.vms 0 "name") }}
+nodes = {{ toJson .Data.nodes }}
+region = {{ .Get "aws.region" | default "us-east-1" | quote }}
+token = {{ b64enc "kado" }}
+tags:{{ .Data.tags | toYaml | nindent 2 }}
+`
+	require.NoError(t, os.WriteFile(tmpl, []byte(body), 0644))
+
+	values := Values{Data: map[string]interface{}{
+		"vms": []interface{}{
+			map[string]interface{}{"name": "web", "cpu": 4},
+			map[string]interface{}{"name": "db"},
+		},
+		"nodes": []interface{}{"pve1", "pve2"},
+		"tags":  map[string]interface{}{"env": "dev"},
+	}}
+	path, err := renderTemplate(tmpl, dir, values)
+	require.NoError(t, err)
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, `web = 4
+db = 2
+first = "web"
+nodes = ["pve1","pve2"]
+region = "us-east-1"
+token = a2Fkbw==
+tags:
+  env: dev
+`, string(content))
+}
+
+func TestProcessTemplateStrict(t *testing.T) {
+	dir := t.TempDir()
+	tmpl := filepath.Join(dir, "t.tmpl")
+	data := map[string]interface{}{"vm": map[string]interface{}{"name": "web"}}
+
+	require.NoError(t, os.WriteFile(tmpl, []byte("<out.txt>\n{{ .Get \"vm.cpu\" }}"), 0644))
+	path, err := renderTemplate(tmpl, dir, Values{Data: data})
+	require.NoError(t, err)
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "", string(content))
+
+	body := "<out.txt>\ncpu={{ .Data.vm.cpu }} disk={{ index .Data.vm \"disk\" }} ip={{ Output \"compute\" \"ip\" }}" +
+		"{{ with .Data.vm }} name={{ .name }} size={{ .size }}{{ end }}{{ define \"x\" }}{{ .nope }}{{ end }} x={{ template \"x\" .Data }}"
+	require.NoError(t, os.WriteFile(tmpl, []byte(body), 0644))
+	path, err = renderTemplate(tmpl, dir, Values{Data: data})
+	require.NoError(t, err)
+	content, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "cpu= disk= ip= name=web size= x=", string(content))
+
+	data["kado"] = map[string]interface{}{"strict_templates": true}
+	outputs := map[string]map[string]interface{}{"compute": {"vm_ips": []interface{}{"10.0.0.5"}}}
+	for body, want := range map[string]string{
+		"{{ .Get \"vm.cpu\" }}":                     `key "vm.cpu" is not set in the data file`,
+		"{{ Get \"vm.cpu\" }}":                      `key "vm.cpu" is not set in the data file`,
+		"{{ .Data.vm.cpu }}":                        `map has no entry for key "cpu"`,
+		"{{ required \"vm.cpu is required\" nil }}": "vm.cpu is required",
+		"{{ Output \"compute\" \"ip\" }}":           `output "ip" of bead "compute" is not set`,
+		"{{ Output \"network\" \"ip\" }}":           `output "ip" of bead "network" is not set`,
+		"{{ Input \"ip\" }}":                        `input "ip" is not set`,
+	} {
+		require.NoError(t, os.WriteFile(tmpl, []byte("<out.txt>\n"+body), 0644))
+		_, err := renderTemplate(tmpl, dir, Values{Data: data, Outputs: outputs})
+		require.Error(t, err, body)
+		assert.Contains(t, err.Error(), want)
+	}
+
+	require.NoError(t, os.WriteFile(tmpl, []byte("<out.txt>\n{{ .Get \"vm.name\" }} {{ .Data.vm.name }} {{ index .Data.vm \"cpu\" | default 2 }} {{ Output \"compute\" \"vm_ips\" }}"), 0644))
+	path, err = renderTemplate(tmpl, dir, Values{Data: data, Outputs: outputs})
+	require.NoError(t, err)
+	content, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "web web 2 [10.0.0.5]", string(content))
+}
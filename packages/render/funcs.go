@@ -0,0 +1,107 @@
+package render
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// funcs are general purpose template functions, named after and behaving
+// like their sprig counterparts, so templates can default and require
+// values and emit them as JSON, which HCL accepts, or YAML.
+var funcs = template.FuncMap{
+	"default":  defaultValue,
+	"required": required,
+	"toJson":   toJSON,
+	"toYaml":   toYAML,
+	"indent":   indent,
+	"nindent":  nindent,
+	"quote":    quote,
+	"b64enc":   b64enc,
+}
+
+// defaultValue returns the given value, or def if it is missing or empty:
+// {{ .Data.vm.cpu | default 2 }}.
+func defaultValue(def interface{}, given ...interface{}) interface{} {
+	if len(given) == 0 || isEmpty(given[0]) {
+		return def
+	}
+	return given[0]
+}
+
+// isEmpty reports whether a value is nil, false, zero or has no elements.
+func isEmpty(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	default:
+		return v.IsZero()
+	}
+}
+
+// required returns val, failing the render with msg if it is missing or an
+// empty string.
+func required(msg string, val interface{}) (interface{}, error) {
+	if val == nil {
+		return nil, fmt.Errorf("%s", msg)
+	}
+	if s, ok := val.(string); ok && s == "" {
+		return nil, fmt.Errorf("%s", msg)
+	}
+	return val, nil
+}
+
+func toJSON(value interface{}) (string, error) {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode JSON: %v", err)
+	}
+	return string(content), nil
+}
+
+func toYAML(value interface{}) (string, error) {
+	content, err := yaml.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode YAML: %v", err)
+	}
+	return strings.TrimSuffix(string(content), "\n"), nil
+}
+
+// indent prefixes every line of text with spaces.
+func indent(spaces int, text string) string {
+	pad := strings.Repeat(" ", spaces)
+	return pad + strings.ReplaceAll(text, "\n", "\n"+pad)
+}
+
+// nindent is indent on a new line, for blocks such as toYaml output.
+func nindent(spaces int, text string) string {
+	return "\n" + indent(spaces, text)
+}
+
+// quote double-quotes and escapes each value, skipping nil ones, and joins
+// them with spaces.
+func quote(values ...interface{}) string {
+	quoted := make([]string, 0, len(values))
+	for _, value := range values {
+		if value != nil {
+			quoted = append(quoted, strconv.Quote(fmt.Sprint(value)))
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+func b64enc(text string) string {
+	return base64.StdEncoding.EncodeToString([]byte(text))
+}
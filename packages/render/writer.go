@@ -7,23 +7,33 @@ import (
 	"path/filepath"
 )
 
+// WriteToFile writes data through a temporary file and renames it into
+// place, so a bead reading the file never sees it half written.
 func WriteToFile(filePath string, data []byte) error {
 	dir := filepath.Dir(filePath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return err
 	}
 
-	file, err := os.Create(filePath)
+	file, err := os.CreateTemp(dir, "."+filepath.Base(filePath)+".*")
 	if err != nil {
 		return err
 	}
-	defer file.Close()
+	defer os.Remove(file.Name())
 
 	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Chmod(0644); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
 		return err
 	}
 
-	return nil
+	return os.Rename(file.Name(), filePath)
 }
 
 func WriteExtraVarsFile(parsedYAMLs []map[string]interface{}, format string) (string, error) {
@@ -0,0 +1,114 @@
+package report
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Skipped  int         `xml:"skipped,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the report as a JUnit XML test suite with one test case
+// per bead, so CI systems can show per-bead results.
+func (r *Report) WriteJUnit(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	suite := junitSuite{
+		Name: "kado " + r.Mode,
+		Time: seconds(r.Duration),
+	}
+	for _, b := range r.Beads {
+		c := junitCase{
+			Name:      b.Name,
+			Classname: "kado." + b.Type,
+			Time:      seconds(b.Duration),
+			SystemOut: details(b),
+		}
+		switch b.Status {
+		case StatusFailed:
+			suite.Failures++
+			c.Failure = &junitMessage{Message: b.Error, Text: b.Error}
+		case StatusSkipped:
+			suite.Skipped++
+			c.Skipped = &junitMessage{Message: b.Reason}
+		}
+		suite.Tests++
+		suite.Cases = append(suite.Cases, c)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(junitSuites{Suites: []junitSuite{suite}}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func details(b *Bead) string {
+	var lines []string
+	if len(b.RelayChain) > 0 {
+		lines = append(lines, "relay chain: "+strings.Join(append(append([]string(nil), b.RelayChain...), b.Name), " -> "))
+	}
+	for _, f := range b.RenderedFiles {
+		lines = append(lines, "rendered: "+f)
+	}
+	if b.PlanFile != "" {
+		lines = append(lines, "plan: "+b.PlanFile)
+	}
+	if b.Plan != nil {
+		lines = append(lines, "plan summary: "+b.Plan.String())
+	}
+	if b.Decision != nil {
+		line := fmt.Sprintf("opa decision: %s allowed=%t", b.Decision.Query, b.Decision.Allowed)
+		if b.Decision.Enforcement != "" {
+			line += " enforcement=" + b.Decision.Enforcement
+		}
+		lines = append(lines, line)
+		for _, m := range b.Decision.Failures {
+			lines = append(lines, "opa failure: "+m.String())
+		}
+		for _, m := range b.Decision.Warnings {
+			lines = append(lines, "opa warning: "+m.String())
+		}
+	}
+	if b.Tests != nil {
+		lines = append(lines, "policy tests: "+b.Tests.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func seconds(s float64) string {
+	return fmt.Sprintf("%.3f", s)
+}
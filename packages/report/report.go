@@ -0,0 +1,247 @@
+// Package report records what happened to every bead during a run and
+// writes it as JSON or JUnit XML.
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusPassed  Status = "passed"
+	StatusFailed  Status = "failed"
+	StatusSkipped Status = "skipped"
+)
+
+const (
+	FormatJSON  = "json"
+	FormatJUnit = "junit"
+
+	// JSONFile and JUnitFile are the names the report is saved under in the
+	// LandingZone.
+	JSONFile  = "kado-report.json"
+	JUnitFile = "kado-report.xml"
+)
+
+// PlanSummary counts the resource changes of a saved plan.
+type PlanSummary struct {
+	Create  int `json:"create"`
+	Update  int `json:"update"`
+	Delete  int `json:"delete"`
+	Replace int `json:"replace"`
+}
+
+func (p PlanSummary) String() string {
+	return fmt.Sprintf("%d to create, %d to update, %d to delete, %d to replace", p.Create, p.Update, p.Delete, p.Replace)
+}
+
+// TestSummary counts the results of the policy unit tests of an OPA bead.
+// Coverage is the percentage of policy lines the tests evaluate.
+type TestSummary struct {
+	Passed   int     `json:"passed"`
+	Failed   int     `json:"failed"`
+	Skipped  int     `json:"skipped"`
+	Coverage float64 `json:"coverage"`
+}
+
+func (t TestSummary) String() string {
+	return fmt.Sprintf("%d passed, %d failed, %d skipped, %.1f%% coverage", t.Passed, t.Failed, t.Skipped, t.Coverage)
+}
+
+// Message is a message produced by a policy rule.
+type Message struct {
+	Rule string `json:"rule"`
+	Msg  string `json:"msg"`
+}
+
+func (m Message) String() string {
+	if m.Msg == "" {
+		return m.Rule
+	}
+	return m.Rule + ": " + m.Msg
+}
+
+// Decision is the outcome of an OPA policy evaluation. Failures are the
+// messages of deny and violation rules, Warnings those of warn rules.
+// Enforcement is the bead's enforcement mode: block, warn or audit.
+type Decision struct {
+	Query       string    `json:"query"`
+	Allowed     bool      `json:"allowed"`
+	Enforcement string    `json:"enforcement,omitempty"`
+	Failures    []Message `json:"failures,omitempty"`
+	Warnings    []Message `json:"warnings,omitempty"`
+}
+
+// Bead is the result of processing one bead. A bead reached both from the
+// graph and through a relay gets one entry per run. The setters are safe to
+// call on a nil *Bead so handlers need not check whether a report is kept.
+type Bead struct {
+	Name          string       `json:"name"`
+	Type          string       `json:"type"`
+	Status        Status       `json:"status"`
+	Started       *time.Time   `json:"started,omitempty"`
+	Duration      float64      `json:"duration_seconds"`
+	RelayChain    []string     `json:"relay_chain,omitempty"`
+	RenderedFiles []string     `json:"rendered_files,omitempty"`
+	PlanFile      string       `json:"plan_file,omitempty"`
+	Plan          *PlanSummary `json:"plan,omitempty"`
+	Decision      *Decision    `json:"opa_decision,omitempty"`
+	Tests         *TestSummary `json:"tests,omitempty"`
+	Error         string       `json:"error,omitempty"`
+	Reason        string       `json:"reason,omitempty"`
+
+	mu sync.Mutex
+}
+
+// AddRenderedFiles records files a bead rendered from templates.
+func (b *Bead) AddRenderedFiles(files ...string) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.RenderedFiles = append(b.RenderedFiles, files...)
+}
+
+// SetPlan records the saved plan and the summary of its changes.
+func (b *Bead) SetPlan(planFile string, summary *PlanSummary) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.PlanFile = planFile
+	b.Plan = summary
+}
+
+// SetDecision records an OPA policy decision.
+func (b *Bead) SetDecision(d Decision) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.Decision = &d
+}
+
+// SetTests records the results of a bead's policy unit tests.
+func (b *Bead) SetTests(summary TestSummary) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.Tests = &summary
+}
+
+// Report is the record of a whole run.
+type Report struct {
+	Mode     string    `json:"mode"`
+	Started  time.Time `json:"started"`
+	Duration float64   `json:"duration_seconds"`
+	Status   Status    `json:"status"`
+	Beads    []*Bead   `json:"beads"`
+
+	mu sync.Mutex
+}
+
+func New(mode string) *Report {
+	return &Report{Mode: mode, Started: time.Now(), Status: StatusPassed, Beads: []*Bead{}}
+}
+
+// Start adds an entry for a bead that is about to run.
+func (r *Report) Start(name, beadType string, relayChain []string) *Bead {
+	now := time.Now()
+	b := &Bead{Name: name, Type: beadType, Started: &now, RelayChain: relayChain}
+	r.mu.Lock()
+	r.Beads = append(r.Beads, b)
+	r.mu.Unlock()
+	return b
+}
+
+// Finish sets the bead's status from err and records its duration.
+func (r *Report) Finish(b *Bead, err error) {
+	b.mu.Lock()
+	b.Duration = time.Since(*b.Started).Seconds()
+	b.Status = StatusPassed
+	if err != nil {
+		b.Status = StatusFailed
+		b.Error = err.Error()
+	}
+	b.mu.Unlock()
+
+	if err != nil {
+		r.mu.Lock()
+		r.Status = StatusFailed
+		r.mu.Unlock()
+	}
+}
+
+// Cancel marks a started bead as skipped because the run was cancelled
+// while it was running.
+func (r *Report) Cancel(b *Bead) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.Duration = time.Since(*b.Started).Seconds()
+	b.Status = StatusSkipped
+	b.Reason = "run cancelled"
+}
+
+// Skip adds an entry for a bead that did not run.
+func (r *Report) Skip(name, beadType, reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Beads = append(r.Beads, &Bead{Name: name, Type: beadType, Status: StatusSkipped, Reason: reason})
+}
+
+// Close records the duration of the run. Call it before writing the report.
+func (r *Report) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Duration = time.Since(r.Started).Seconds()
+}
+
+func (r *Report) WriteJSON(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// Write writes the report in the given format.
+func (r *Report) Write(w io.Writer, format string) error {
+	switch format {
+	case FormatJSON:
+		return r.WriteJSON(w)
+	case FormatJUnit:
+		return r.WriteJUnit(w)
+	default:
+		return fmt.Errorf("unknown report format %q, expected %s or %s", format, FormatJSON, FormatJUnit)
+	}
+}
+
+// Save writes the report to dir as JSON and JUnit XML.
+func (r *Report) Save(dir string) error {
+	for name, format := range map[string]string{JSONFile: FormatJSON, JUnitFile: FormatJUnit} {
+		f, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			return fmt.Errorf("failed to create report file: %v", err)
+		}
+		err = r.Write(f, format)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write report file %s: %v", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sampleReport() *Report {
+	r := New("apply")
+	network := r.Start("network", "terraform", nil)
+	network.AddRenderedFiles("LandingZone/vm.tfvars")
+	network.SetPlan("LandingZone/network/plan.out", &PlanSummary{Create: 2, Delete: 1})
+	r.Finish(network, nil)
+
+	policy := r.Start("policy", "opa", []string{"network"})
+	policy.SetDecision(Decision{
+		Query:       "data.main",
+		Enforcement: "block",
+		Failures:    []Message{{Rule: "deny", Msg: "vm is public"}},
+		Warnings:    []Message{{Rule: "warn_tags", Msg: "vm has no tags"}},
+	})
+	policy.SetTests(TestSummary{Passed: 3, Failed: 1, Coverage: 87.5})
+	r.Finish(policy, errors.New("denied"))
+
+	r.Skip("ansible", "ansible", "dependency network failed")
+	r.Close()
+	return r
+}
+
+func TestWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, sampleReport().Write(&buf, FormatJSON))
+
+	var got struct {
+		Mode   string
+		Status Status
+		Beads  []Bead
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+	assert.Equal(t, "apply", got.Mode)
+	assert.Equal(t, StatusFailed, got.Status)
+	require.Len(t, got.Beads, 3)
+	assert.Equal(t, StatusPassed, got.Beads[0].Status)
+	assert.Equal(t, &PlanSummary{Create: 2, Delete: 1}, got.Beads[0].Plan)
+	assert.Equal(t, []string{"network"}, got.Beads[1].RelayChain)
+	assert.Equal(t, &Decision{
+		Query:       "data.main",
+		Enforcement: "block",
+		Failures:    []Message{{Rule: "deny", Msg: "vm is public"}},
+		Warnings:    []Message{{Rule: "warn_tags", Msg: "vm has no tags"}},
+	}, got.Beads[1].Decision)
+	assert.Equal(t, &TestSummary{Passed: 3, Failed: 1, Coverage: 87.5}, got.Beads[1].Tests)
+	assert.Equal(t, "denied", got.Beads[1].Error)
+	assert.Equal(t, StatusSkipped, got.Beads[2].Status)
+}
+
+func TestWriteJUnit(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, sampleReport().Write(&buf, FormatJUnit))
+	out := buf.String()
+
+	assert.Contains(t, out, `<testsuite name="kado apply" tests="3" failures="1" skipped="1"`)
+	assert.Contains(t, out, `<testcase name="network" classname="kado.terraform"`)
+	assert.Contains(t, out, "plan summary: 2 to create, 0 to update, 1 to delete, 0 to replace")
+	assert.Contains(t, out, "opa decision: data.main allowed=false enforcement=block")
+	assert.Contains(t, out, "opa failure: deny: vm is public")
+	assert.Contains(t, out, "policy tests: 3 passed, 1 failed, 0 skipped, 87.5% coverage")
+	assert.Contains(t, out, "opa warning: warn_tags: vm has no tags")
+	assert.Contains(t, out, `<failure message="denied">denied</failure>`)
+	assert.Contains(t, out, "relay chain: network -&gt; policy")
+	assert.Contains(t, out, `<skipped message="dependency network failed"></skipped>`)
+}
+
+func TestSave(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, sampleReport().Save(dir))
+	for _, name := range []string{JSONFile, JUnitFile} {
+		_, err := os.Stat(filepath.Join(dir, name))
+		assert.NoError(t, err, name)
+	}
+	assert.Error(t, sampleReport().Write(&bytes.Buffer{}, "yaml"))
+}
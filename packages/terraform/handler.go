@@ -0,0 +1,107 @@
+package terraform
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/janpreet/kado/packages/bead"
+	"github.com/janpreet/kado/packages/render"
+)
+
+// Handler runs terraform beads.
+type Handler struct{}
+
+func init() {
+	bead.Register("terraform", Handler{})
+}
+
+// Schema declares the fields of terraform beads.
+func (Handler) Schema() []bead.Field {
+	return []bead.Field{
+		{Name: "templates", Type: bead.TypeList, Description: "Templates rendered into the bead's own directory instead of the shared kado.templates list."},
+		{Name: "allow_destroy", Type: bead.TypeBool, Default: false, Description: "Allow apply to delete or replace resources."},
+	}
+}
+
+func (Handler) Validate(b bead.Bead) error {
+	return nil
+}
+
+func (Handler) Plan(ctx *bead.Context, b bead.Bead) error {
+	if err := os.Remove(filepath.Join(ctx.LandingZone, b.Name, OutputsFile)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove stale outputs: %v", err)
+	}
+	ctx.Log().Info("Processing Terraform templates")
+	templates, ok := render.BeadTemplates(ctx.LandingZone, ctx.Data, b)
+	if !ok {
+		return fmt.Errorf("no templates defined for Terraform in the YAML configuration")
+	}
+	var varFiles []string
+	var consume func() error
+	if !templates.Own {
+		consume = func() error {
+			var err error
+			varFiles, err = StageVarFiles(ctx, b)
+			return err
+		}
+	}
+	rendered, err := render.RenderTemplates(templates, render.Values{Data: ctx.Data, Outputs: ctx.Outputs, Inputs: ctx.Inputs}, consume)
+	ctx.Result.AddRenderedFiles(rendered...)
+	if err != nil {
+		return fmt.Errorf("failed to process Terraform templates: %v", err)
+	}
+	if templates.Own {
+		varFiles = renderedVarFiles(templates.Dir, rendered)
+	}
+	ctx.Log().Debug("Running Terraform plan")
+	err = RunTerraformPlan(ctx, b, varFiles)
+	if err != nil {
+		return fmt.Errorf("failed to run Terraform: %v", err)
+	}
+	// Templates of later beads read the outputs of the infrastructure that
+	// already exists, even when this run only plans.
+	return SaveOutputs(ctx, b)
+}
+
+func (Handler) Apply(ctx *bead.Context, b bead.Bead) error {
+	err := ApplyTerraformPlan(ctx, b)
+	if err != nil {
+		return fmt.Errorf("failed to run Terraform: %v", err)
+	}
+	if ctx.Destroy {
+		// The outputs saved by the plan are of what was just destroyed.
+		if err := os.Remove(filepath.Join(ctx.LandingZone, b.Name, OutputsFile)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove outputs: %v", err)
+		}
+		return nil
+	}
+	return SaveOutputs(ctx, b)
+}
+
+// CanDestroy makes terraform beads part of `kado destroy`.
+func (Handler) CanDestroy() bool {
+	return true
+}
+
+// Outputs returns the values of the bead's terraform outputs, as saved by
+// the last plan or apply, and the saved plan under PlanOutput and
+// PlanJSONOutput.
+func (Handler) Outputs(ctx *bead.Context, b bead.Bead) (map[string]interface{}, error) {
+	repoPath := filepath.Join(ctx.LandingZone, b.Name)
+	values, err := ReadOutputs(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	outputs := make(map[string]interface{}, len(values)+2)
+	for name, value := range values {
+		outputs[name] = value
+	}
+	for name, path := range map[string]string{PlanOutput: "plan.out", PlanJSONOutput: "plan.json"} {
+		if _, ok := outputs[name]; ok {
+			ctx.Log().Warn("Terraform output hidden by the saved plan, rename it", "output", name)
+		}
+		outputs[name] = filepath.Join(repoPath, path)
+	}
+	return outputs, nil
+}
@@ -0,0 +1,74 @@
+package terraform
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/janpreet/kado/packages/bead"
+)
+
+// OutputsFile is where SaveOutputs stores the output values of an applied
+// bead, next to its plan.
+const OutputsFile = "outputs.json"
+
+// Keys of the saved plan among the outputs of a bead. They start with an
+// underscore so that they are told apart from the terraform outputs.
+const (
+	PlanOutput     = "_plan"
+	PlanJSONOutput = "_plan_json"
+)
+
+// outputValue is one entry of `terraform output -json`.
+type outputValue struct {
+	Sensitive bool        `json:"sensitive"`
+	Value     interface{} `json:"value"`
+}
+
+// SaveOutputs runs `terraform output -json` in the bead's repository and
+// saves the output values of its current state, by output name, as
+// outputs.json. It runs after the plan, for the infrastructure as it is, and
+// again after an apply.
+func SaveOutputs(ctx *bead.Context, b bead.Bead) error {
+	repoPath := filepath.Join(ctx.LandingZone, b.Name)
+	data, err := runCommandWithOutput(ctx, repoPath, "terraform", "output", "-json")
+	if err != nil {
+		return fmt.Errorf("failed to run terraform output: %v", err)
+	}
+	var outputs map[string]outputValue
+	if err := json.Unmarshal(data, &outputs); err != nil {
+		return fmt.Errorf("failed to parse terraform output: %v", err)
+	}
+	values := make(map[string]interface{}, len(outputs))
+	for name, output := range outputs {
+		values[name] = output.Value
+	}
+	data, err = json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(repoPath, OutputsFile)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %v", OutputsFile, err)
+	}
+	ctx.Log().Info("Terraform outputs saved", "path", path, "count", len(values))
+	return nil
+}
+
+// ReadOutputs returns the output values saved by SaveOutputs, or nil when
+// they were not saved.
+func ReadOutputs(repoPath string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(filepath.Join(repoPath, OutputsFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", OutputsFile, err)
+	}
+	return values, nil
+}
@@ -0,0 +1,72 @@
+package terraform
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/janpreet/kado/packages/bead"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutputs(t *testing.T) {
+	lz := t.TempDir()
+	repo := filepath.Join(lz, "compute")
+	require.NoError(t, os.MkdirAll(repo, 0755))
+	ctx := &bead.Context{LandingZone: lz}
+	b := bead.Bead{Name: "compute"}
+
+	outputs, err := Handler{}.Outputs(ctx, b)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		PlanOutput:     filepath.Join(repo, "plan.out"),
+		PlanJSONOutput: filepath.Join(repo, "plan.json"),
+	}, outputs)
+
+	require.NoError(t, os.WriteFile(filepath.Join(repo, OutputsFile), []byte(`{"vm_ips": ["10.0.0.1", "10.0.0.2"], "plan": "p", "_plan": "x"}`), 0600))
+	outputs, err = Handler{}.Outputs(ctx, b)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"10.0.0.1", "10.0.0.2"}, outputs["vm_ips"])
+	assert.Equal(t, "p", outputs["plan"])
+	assert.Equal(t, filepath.Join(repo, "plan.out"), outputs[PlanOutput])
+}
+
+// fakeTerraform puts a terraform on PATH that plans nothing and has the
+// given outputs in its state.
+func fakeTerraform(t *testing.T, outputs string) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake terraform is a shell script")
+	}
+	bin := t.TempDir()
+	script := "#!/bin/sh\n" +
+		"case \"$1\" in\n" +
+		"show) echo '{\"resource_changes\": []}' ;;\n" +
+		"output) echo '" + outputs + "' ;;\n" +
+		"esac\n"
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "terraform"), []byte(script), 0755))
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestPlanReadsOutputsOfState(t *testing.T) {
+	fakeTerraform(t, `{"vm_ips": {"sensitive": false, "value": ["10.0.0.1"]}}`)
+	lz := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(lz, "compute"), 0755))
+	tmpl := filepath.Join(lz, "vm.tfvars.tmpl")
+	require.NoError(t, os.WriteFile(tmpl, []byte("<vm.tfvars>\ncpu = 2\n"), 0644))
+	b := bead.Bead{Name: "compute", Fields: map[string]string{}, Values: map[string]interface{}{"templates": []interface{}{tmpl}}}
+	ctx := &bead.Context{LandingZone: lz, Stdout: io.Discard, Stderr: io.Discard}
+
+	require.NoError(t, Handler{}.Plan(ctx, b))
+	outputs, err := Handler{}.Outputs(ctx, b)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"10.0.0.1"}, outputs["vm_ips"])
+
+	ctx.Apply, ctx.Destroy = true, true
+	require.NoError(t, Handler{}.Apply(ctx, b))
+	outputs, err = Handler{}.Outputs(ctx, b)
+	require.NoError(t, err)
+	assert.NotContains(t, outputs, "vm_ips")
+}
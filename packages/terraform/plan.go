@@ -0,0 +1,117 @@
+package terraform
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/janpreet/kado/packages/bead"
+	"github.com/janpreet/kado/packages/report"
+)
+
+// Plan is the part of `terraform show -json` output kado reads.
+type Plan struct {
+	ResourceChanges []ResourceChange `json:"resource_changes"`
+}
+
+type ResourceChange struct {
+	Address string `json:"address"`
+	Change  struct {
+		Actions []string `json:"actions"`
+	} `json:"change"`
+}
+
+// Action classifies the change as create, update, delete, replace or no-op.
+func (rc ResourceChange) Action() string {
+	actions := rc.Change.Actions
+	switch {
+	case len(actions) == 2 && contains(actions, "create") && contains(actions, "delete"):
+		return "replace"
+	case len(actions) == 1 && (actions[0] == "create" || actions[0] == "update" || actions[0] == "delete"):
+		return actions[0]
+	default:
+		return "no-op"
+	}
+}
+
+// ReadPlan parses a plan.json written by `terraform show -json`.
+func ReadPlan(path string) (*Plan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plan: %v", err)
+	}
+	var plan Plan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("failed to parse plan %s: %v", path, err)
+	}
+	return &plan, nil
+}
+
+// Summary counts the plan's changes by action.
+func (p *Plan) Summary() report.PlanSummary {
+	var s report.PlanSummary
+	for _, rc := range p.ResourceChanges {
+		switch rc.Action() {
+		case "create":
+			s.Create++
+		case "update":
+			s.Update++
+		case "delete":
+			s.Delete++
+		case "replace":
+			s.Replace++
+		}
+	}
+	return s
+}
+
+// Destroys returns the addresses of resources the plan deletes, including
+// those it replaces.
+func (p *Plan) Destroys() []string {
+	var addresses []string
+	for _, rc := range p.ResourceChanges {
+		if action := rc.Action(); action == "delete" || action == "replace" {
+			addresses = append(addresses, rc.Address)
+		}
+	}
+	return addresses
+}
+
+// SummarizePlan reads the plan.json, logs its summary and records it in the
+// run report.
+func SummarizePlan(ctx *bead.Context, planFile, planJSONPath string) (*Plan, error) {
+	plan, err := ReadPlan(planJSONPath)
+	if err != nil {
+		return nil, err
+	}
+	summary := plan.Summary()
+	ctx.Log().Info("Plan: "+summary.String(), "create", summary.Create, "update", summary.Update, "delete", summary.Delete, "replace", summary.Replace)
+	ctx.Result.SetPlan(planFile, &summary)
+	return plan, nil
+}
+
+// CheckDestroy refuses to apply a plan that deletes or replaces resources
+// unless the bead sets allow_destroy = true. `kado destroy` is exempt.
+func CheckDestroy(ctx *bead.Context, b bead.Bead, planJSONPath string) error {
+	if ctx.Destroy || b.Fields["allow_destroy"] == "true" {
+		return nil
+	}
+	plan, err := ReadPlan(planJSONPath)
+	if err != nil {
+		return err
+	}
+	if destroys := plan.Destroys(); len(destroys) > 0 {
+		return fmt.Errorf("plan for bead %s deletes or replaces %d resource(s) (%s); set allow_destroy = true on the bead to apply it", b.Name, len(destroys), strings.Join(destroys, ", "))
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+package terraform
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/janpreet/kado/packages/bead"
+	"github.com/janpreet/kado/packages/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const samplePlan = `{
+  "format_version": "1.2",
+  "resource_changes": [
+    {"address": "proxmox_vm.web[0]", "change": {"actions": ["create"]}},
+    {"address": "proxmox_vm.web[1]", "change": {"actions": ["update"]}},
+    {"address": "proxmox_vm.db", "change": {"actions": ["delete", "create"]}},
+    {"address": "proxmox_vm.old", "change": {"actions": ["delete"]}},
+    {"address": "data.proxmox_node.n", "change": {"actions": ["read"]}},
+    {"address": "proxmox_vm.same", "change": {"actions": ["no-op"]}}
+  ]
+}`
+
+func writePlan(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "plan.json")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestPlanSummary(t *testing.T) {
+	plan, err := ReadPlan(writePlan(t, samplePlan))
+	require.NoError(t, err)
+	assert.Equal(t, report.PlanSummary{Create: 1, Update: 1, Delete: 1, Replace: 1}, plan.Summary())
+	assert.Equal(t, []string{"proxmox_vm.db", "proxmox_vm.old"}, plan.Destroys())
+}
+
+func TestCheckDestroy(t *testing.T) {
+	path := writePlan(t, samplePlan)
+	b := bead.Bead{Name: "network", Fields: map[string]string{}}
+
+	err := CheckDestroy(&bead.Context{}, b, path)
+	assert.EqualError(t, err, "plan for bead network deletes or replaces 2 resource(s) (proxmox_vm.db, proxmox_vm.old); set allow_destroy = true on the bead to apply it")
+
+	assert.NoError(t, CheckDestroy(&bead.Context{Destroy: true}, b, path))
+
+	b.Fields["allow_destroy"] = "true"
+	assert.NoError(t, CheckDestroy(&bead.Context{}, b, path))
+
+	assert.NoError(t, CheckDestroy(&bead.Context{}, bead.Bead{Name: "x"}, writePlan(t, `{"resource_changes": []}`)))
+}
@@ -1,37 +1,36 @@
 package terraform
 
 import (
+	"bytes"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 
 	"github.com/janpreet/kado/packages/bead"
 )
 
-func HandleTerraform(b bead.Bead, landingZone string, applyPlan bool) error {
-	fmt.Printf("Processing terraform bead:\n")
-	for key, val := range b.Fields {
-		fmt.Printf("  %s = %s\n", key, val)
-	}
+// StageVarFiles moves the rendered .tfvars files and backend.tfvars from the
+// landing zone into the bead's repository and returns the var file names.
+func StageVarFiles(ctx *bead.Context, b bead.Bead) ([]string, error) {
+	ctx.Log().Debug("Processing terraform bead", "fields", b.LogFields())
 
-	fmt.Println("Getting tfvars files from landing zone:", landingZone)
-	varFiles, err := getTfvarsFiles(landingZone)
+	landingZone := ctx.LandingZone
+	varFiles, err := getTfvarsFiles(ctx, landingZone)
 	if err != nil {
-		return fmt.Errorf("failed to get tfvars files: %v", err)
+		return nil, fmt.Errorf("failed to get tfvars files: %v", err)
 	}
 
 	repoPath := filepath.Join(landingZone, b.Name)
-	planArgs := []string{"plan", "-out=plan.out"}
+	var staged []string
 	for _, varFile := range varFiles {
 
 		destPath := filepath.Join(repoPath, filepath.Base(varFile))
 		err := moveFile(varFile, destPath)
 		if err != nil {
-			return fmt.Errorf("failed to move tfvars file: %v", err)
+			return nil, fmt.Errorf("failed to move tfvars file: %v", err)
 		}
-		planArgs = append(planArgs, "--var-file", filepath.Base(varFile))
+		staged = append(staged, filepath.Base(varFile))
 	}
 
 	backendConfigFile := filepath.Join(landingZone, "backend.tfvars")
@@ -39,31 +38,62 @@ func HandleTerraform(b bead.Bead, landingZone string, applyPlan bool) error {
 		destBackendPath := filepath.Join(repoPath, "backend.tfvars")
 		err := moveFile(backendConfigFile, destBackendPath)
 		if err != nil {
-			return fmt.Errorf("failed to move backend.tfvars file: %v", err)
+			return nil, fmt.Errorf("failed to move backend.tfvars file: %v", err)
 		}
 	}
 
+	return staged, nil
+}
+
+// renderedVarFiles returns the .tfvars files a bead rendered into its own
+// repository at repoPath, relative to it. backend.tfvars is passed to init
+// instead.
+func renderedVarFiles(repoPath string, rendered []string) []string {
+	var varFiles []string
+	for _, path := range rendered {
+		name, err := filepath.Rel(repoPath, path)
+		if err != nil || !strings.HasSuffix(name, ".tfvars") || name == "backend.tfvars" {
+			continue
+		}
+		varFiles = append(varFiles, name)
+	}
+	return varFiles
+}
+
+// RunTerraformPlan runs init and plan with the staged var files and saves the
+// plan as plan.out and plan.json for ApplyTerraformPlan. With ctx.Destroy the
+// saved plan is a destroy plan.
+func RunTerraformPlan(ctx *bead.Context, b bead.Bead, varFiles []string) error {
+	repoPath := filepath.Join(ctx.LandingZone, b.Name)
+	planArgs := []string{"plan", "-out=plan.out"}
+	if ctx.Destroy {
+		planArgs = append(planArgs, "-destroy")
+	}
+	for _, varFile := range varFiles {
+		planArgs = append(planArgs, "--var-file", varFile)
+	}
+
 	initArgs := []string{"init"}
 
 	if fileExists(filepath.Join(repoPath, "backend.tfvars")) {
 		initArgs = append(initArgs, "-backend-config=backend.tfvars")
 	}
 
-	fmt.Println("Running terraform init...")
-	err = runCommand(repoPath, "terraform", initArgs...)
+	ctx.Log().Debug("Running terraform init")
+	err := ctx.Command(repoPath, "terraform", initArgs...).Run()
 	if err != nil {
 		return fmt.Errorf("failed to run terraform init: %v", err)
 	}
 
-	fmt.Println("Running terraform plan...")
-	err = runCommand(repoPath, "terraform", planArgs...)
+	ctx.Log().Debug("Running terraform plan", "destroy", ctx.Destroy)
+	err = ctx.Command(repoPath, "terraform", planArgs...).Run()
 	if err != nil {
 		return fmt.Errorf("failed to run terraform plan: %v", err)
 	}
 
-	fmt.Println("Converting plan.out to plan.json...")
+	ctx.Log().Debug("Converting plan.out to plan.json")
 	showArgs := []string{"show", "-no-color", "-json", "plan.out"}
-	output, err := runCommandWithOutput(repoPath, "terraform", showArgs...)
+	output, err := runCommandWithOutput(ctx, repoPath, "terraform", showArgs...)
 	if err != nil {
 		return fmt.Errorf("failed to run terraform show: %v", err)
 	}
@@ -74,39 +104,39 @@ func HandleTerraform(b bead.Bead, landingZone string, applyPlan bool) error {
 		return fmt.Errorf("failed to write plan.json: %v", err)
 	}
 
-	fmt.Println("Terraform plan saved as plan.json")
-
-	if applyPlan {
-
-		applyArgs := []string{"apply", "plan.out"}
-		fmt.Println("Applying terraform plan...")
-		err = runCommand(repoPath, "terraform", applyArgs...)
-		if err != nil {
-			return fmt.Errorf("failed to apply terraform plan: %v", err)
-		}
+	ctx.Log().Info("Terraform plan saved", "path", planJSONPath)
+	if _, err := SummarizePlan(ctx, filepath.Join(repoPath, "plan.out"), planJSONPath); err != nil {
+		return err
 	}
 
 	return nil
 }
 
-func runCommand(dir, name string, args ...string) error {
-	fmt.Printf("Executing command: %s %s in directory: %s\n", name, strings.Join(args, " "), dir)
-	cmd := exec.Command(name, args...)
-	cmd.Dir = dir
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
+// ApplyTerraformPlan applies the plan.out saved by RunTerraformPlan.
+func ApplyTerraformPlan(ctx *bead.Context, b bead.Bead) error {
+	repoPath := filepath.Join(ctx.LandingZone, b.Name)
+	if err := CheckDestroy(ctx, b, filepath.Join(repoPath, "plan.json")); err != nil {
+		return err
+	}
+	applyArgs := []string{"apply", "plan.out"}
+	ctx.Log().Info("Applying terraform plan", "dir", repoPath)
+	err := ctx.Command(repoPath, "terraform", applyArgs...).Run()
+	if err != nil {
+		return fmt.Errorf("failed to apply terraform plan: %v", err)
+	}
+	return nil
 }
 
-func runCommandWithOutput(dir, name string, args ...string) ([]byte, error) {
-	fmt.Printf("Executing command: %s %s in directory: %s\n", name, strings.Join(args, " "), dir)
-	cmd := exec.Command(name, args...)
-	cmd.Dir = dir
-	return cmd.Output()
+func runCommandWithOutput(ctx *bead.Context, dir, name string, args ...string) ([]byte, error) {
+	cmd := ctx.Command(dir, name, args...)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	err := cmd.Run()
+	return stdout.Bytes(), err
 }
 
-func getTfvarsFiles(directory string) ([]string, error) {
-	fmt.Println("Reading tfvars files from directory:", directory)
+func getTfvarsFiles(ctx *bead.Context, directory string) ([]string, error) {
+	ctx.Log().Debug("Reading tfvars files", "dir", directory)
 	files, err := os.ReadDir(directory)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read directory: %v", err)
@@ -121,7 +151,7 @@ func getTfvarsFiles(directory string) ([]string, error) {
 			varFiles = append(varFiles, filepath.Join(directory, file.Name()))
 		}
 	}
-	fmt.Println("Found tfvars files:", varFiles)
+	ctx.Log().Debug("Found tfvars files", "files", varFiles)
 	return varFiles, nil
 }
 
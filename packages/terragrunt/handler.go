@@ -0,0 +1,69 @@
+package terragrunt
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/janpreet/kado/packages/bead"
+	"github.com/janpreet/kado/packages/render"
+	"github.com/janpreet/kado/packages/terraform"
+)
+
+// Handler runs terragrunt beads.
+type Handler struct{}
+
+func init() {
+	bead.Register("terragrunt", Handler{})
+}
+
+// Schema declares the fields of terragrunt beads.
+func (Handler) Schema() []bead.Field {
+	return []bead.Field{
+		{Name: "templates", Type: bead.TypeList, Description: "Templates rendered into the bead's own directory instead of the shared kado.templates list."},
+		{Name: "allow_destroy", Type: bead.TypeBool, Default: false, Description: "Allow apply to delete or replace resources."},
+	}
+}
+
+func (Handler) Validate(b bead.Bead) error {
+	return nil
+}
+
+func (Handler) Plan(ctx *bead.Context, b bead.Bead) error {
+	ctx.Log().Info("Processing Terragrunt templates")
+	templates, ok := render.BeadTemplates(ctx.LandingZone, ctx.Data, b)
+	if !ok {
+		return fmt.Errorf("no templates defined for Terragrunt in the YAML configuration")
+	}
+	rendered, err := render.ProcessTemplates(templates, render.Values{Data: ctx.Data, Outputs: ctx.Outputs, Inputs: ctx.Inputs})
+	ctx.Result.AddRenderedFiles(rendered...)
+	if err != nil {
+		return fmt.Errorf("failed to process Terragrunt templates: %v", err)
+	}
+	ctx.Log().Debug("Running Terragrunt plan")
+	err = HandleTerragrunt(ctx, b)
+	if err != nil {
+		return fmt.Errorf("failed to run Terragrunt: %v", err)
+	}
+	return nil
+}
+
+func (Handler) Apply(ctx *bead.Context, b bead.Bead) error {
+	err := ApplyTerragruntPlan(ctx, b)
+	if err != nil {
+		return fmt.Errorf("failed to run Terragrunt: %v", err)
+	}
+	return nil
+}
+
+// CanDestroy makes terragrunt beads part of `kado destroy`.
+func (Handler) CanDestroy() bool {
+	return true
+}
+
+func (Handler) Outputs(ctx *bead.Context, b bead.Bead) (map[string]interface{}, error) {
+	repoPath := filepath.Join(ctx.LandingZone, b.Name)
+	return map[string]interface{}{
+		terraform.PlanOutput:     filepath.Join(repoPath, "plan.out"),
+		terraform.PlanJSONOutput: filepath.Join(repoPath, "plan.json"),
+	}, nil
+}
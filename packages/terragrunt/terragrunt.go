@@ -1,62 +1,67 @@
 package terragrunt
 
 import (
-    "fmt"
-    "os"
-    "os/exec"
-    "path/filepath"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
 
-    "github.com/janpreet/kado/packages/bead"
+	"github.com/janpreet/kado/packages/bead"
+	"github.com/janpreet/kado/packages/terraform"
 )
 
-func HandleTerragrunt(b bead.Bead, landingZone string, applyPlan bool) error {
-    repoPath := filepath.Join(landingZone, b.Name)
+func HandleTerragrunt(ctx *bead.Context, b bead.Bead) error {
+	repoPath := filepath.Join(ctx.LandingZone, b.Name)
 
-    terragruntPlanPath := filepath.Join(repoPath, "plan.out")
-    terragruntJSONPath := filepath.Join(repoPath, "plan.json")
+	terragruntPlanPath := filepath.Join(repoPath, "plan.out")
+	terragruntJSONPath := filepath.Join(repoPath, "plan.json")
 
-    fmt.Println("Running Terragrunt plan...")
-    cmd := exec.Command("terragrunt", "plan", "-out", terragruntPlanPath)
-    cmd.Dir = repoPath
+	planArgs := []string{"plan", "-out", terragruntPlanPath}
+	if ctx.Destroy {
+		planArgs = append(planArgs, "-destroy")
+	}
 
-    output, err := cmd.CombinedOutput()
-    if err != nil {
-        fmt.Printf("Terragrunt plan output: %s\n", string(output))
-        return fmt.Errorf("failed to run Terragrunt plan: %v", err)
-    }
+	ctx.Log().Info("Running Terragrunt plan", "destroy", ctx.Destroy)
+	err := ctx.Command(repoPath, "terragrunt", planArgs...).Run()
+	if err != nil {
+		return fmt.Errorf("failed to run Terragrunt plan: %v", err)
+	}
 
-    fmt.Println("Converting Terragrunt plan to JSON...")
-    cmd = exec.Command("terragrunt", "show", "-json", terragruntPlanPath)
-    cmd.Dir = repoPath
+	ctx.Log().Debug("Converting Terragrunt plan to JSON")
+	cmd := ctx.Command(repoPath, "terragrunt", "show", "-json", terragruntPlanPath)
+	var jsonOutput bytes.Buffer
+	cmd.Stdout = &jsonOutput
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to convert Terragrunt plan to JSON: %v", err)
+	}
 
-    jsonOutput, err := cmd.CombinedOutput()
-    if err != nil {
-        fmt.Printf("Terragrunt show output: %s\n", string(jsonOutput))
-        return fmt.Errorf("failed to convert Terragrunt plan to JSON: %v", err)
-    }
+	err = os.WriteFile(terragruntJSONPath, jsonOutput.Bytes(), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write JSON plan to file: %v", err)
+	}
 
-    err = os.WriteFile(terragruntJSONPath, jsonOutput, 0644)
-    if err != nil {
-        return fmt.Errorf("failed to write JSON plan to file: %v", err)
-    }
+	ctx.Log().Info("Terragrunt plan saved", "path", terragruntJSONPath)
+	if _, err := terraform.SummarizePlan(ctx, terragruntPlanPath, terragruntJSONPath); err != nil {
+		return err
+	}
 
-    fmt.Println("Terragrunt plan saved to:", terragruntJSONPath)
-
-    if !applyPlan {
-        fmt.Println("Skipping Terragrunt apply due to missing 'set' flag.")
-        return nil
-    }
+	return nil
+}
 
-    fmt.Println("Running Terragrunt apply...")
-    cmd = exec.Command("terragrunt", "apply", terragruntPlanPath)
-    cmd.Dir = repoPath
+// ApplyTerragruntPlan applies the plan.out saved by HandleTerragrunt.
+func ApplyTerragruntPlan(ctx *bead.Context, b bead.Bead) error {
+	repoPath := filepath.Join(ctx.LandingZone, b.Name)
+	terragruntPlanPath := filepath.Join(repoPath, "plan.out")
+	if err := terraform.CheckDestroy(ctx, b, filepath.Join(repoPath, "plan.json")); err != nil {
+		return err
+	}
 
-    applyOutput, err := cmd.CombinedOutput()
-    if err != nil {
-        fmt.Printf("Terragrunt apply output: %s\n", string(applyOutput))
-        return fmt.Errorf("failed to run Terragrunt apply: %v", err)
-    }
+	ctx.Log().Info("Running Terragrunt apply", "dir", repoPath)
+	err := ctx.Command(repoPath, "terragrunt", "apply", terragruntPlanPath).Run()
+	if err != nil {
+		return fmt.Errorf("failed to run Terragrunt apply: %v", err)
+	}
 
-    fmt.Println("Terragrunt apply completed.")
-    return nil
+	ctx.Log().Info("Terragrunt apply completed")
+	return nil
 }
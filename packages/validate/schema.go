@@ -0,0 +1,180 @@
+package validate
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"gopkg.in/yaml.v3"
+)
+
+// KadoSchema describes the kado section of the data file. It is added to the
+// user's schema by DataSchema; the user's schema itself is checked against
+// the data file without the kado section.
+var KadoSchema = map[string]interface{}{
+	"type":        "object",
+	"description": "Settings of kado itself.",
+	"properties": map[string]interface{}{
+		"templates": map[string]interface{}{
+			"description": "Templates rendered for every bead, or a list of templates per bead name.",
+			"oneOf": []interface{}{
+				map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+				map[string]interface{}{"type": "object", "additionalProperties": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}}},
+			},
+		},
+		"schema": map[string]interface{}{
+			"type":        "string",
+			"description": "JSON Schema the rest of the data file is checked against.",
+		},
+		"strict_templates": map[string]interface{}{
+			"type":        "boolean",
+			"description": "Fail rendering templates that use a key the data file does not set.",
+		},
+	},
+}
+
+// dataSchemaPath returns the path of the JSON Schema set as kado.schema in
+// the data file, if any.
+func dataSchemaPath(root *yaml.Node) string {
+	kado := mappingValue(root, "kado")
+	if kado == nil || kado.Kind != yaml.MappingNode {
+		return ""
+	}
+	schema := mappingValue(kado, "schema")
+	if schema == nil || schema.Kind != yaml.ScalarNode {
+		return ""
+	}
+	return schema.Value
+}
+
+// DataSchema returns the JSON Schema set as kado.schema in the data file at
+// path, with KadoSchema added as its kado property, for editors to check the
+// data file with. It returns nil if the data file sets no schema.
+func DataSchema(path string) (map[string]interface{}, error) {
+	root, err := readData(path)
+	if err != nil {
+		return nil, err
+	}
+	schemaPath := dataSchemaPath(root)
+	if schemaPath == "" {
+		return nil, nil
+	}
+	content, err := os.ReadFile(schemaPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema: %v", err)
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(content, &schema); err != nil {
+		return nil, fmt.Errorf("failed to parse schema %s: %v", schemaPath, err)
+	}
+	properties, _ := schema["properties"].(map[string]interface{})
+	if properties == nil {
+		properties = make(map[string]interface{})
+		schema["properties"] = properties
+	}
+	properties["kado"] = KadoSchema
+	return schema, nil
+}
+
+func readData(path string) (*yaml.Node, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data file: %v", err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse data file: %v", err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("the data file must be a mapping of keys to values")
+	}
+	return doc.Content[0], nil
+}
+
+// schema checks the data file, without its kado section, against the JSON
+// Schema set as kado.schema. Each violation is reported at the value it is
+// about.
+func (p *Problems) schema(path string, root *yaml.Node) {
+	schemaPath := dataSchemaPath(root)
+	if schemaPath == "" {
+		return
+	}
+	kado := mappingValue(mappingValue(root, "kado"), "schema")
+	schema, err := jsonschema.Compile(schemaPath)
+	if err != nil {
+		p.add(nodePos(path, kado), "failed to load schema %s: %v", schemaPath, err)
+		return
+	}
+
+	var data map[string]interface{}
+	if err := root.Decode(&data); err != nil {
+		p.add(nodePos(path, root), "failed to decode data file: %v", err)
+		return
+	}
+	delete(data, "kado")
+	err = schema.Validate(data)
+	if err == nil {
+		return
+	}
+	validationErr, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		p.add(nodePos(path, root), "data file does not match schema %s: %v", schemaPath, err)
+		return
+	}
+	for _, leaf := range leafErrors(validationErr) {
+		location := leaf.InstanceLocation
+		if location == "" {
+			location = "/"
+		}
+		p.add(nodePos(path, lookupPointer(root, leaf.InstanceLocation)), "%s: %s", location, leaf.Message)
+	}
+}
+
+// leafErrors returns the innermost causes of a validation error, which name
+// the values that do not match.
+func leafErrors(err *jsonschema.ValidationError) []*jsonschema.ValidationError {
+	if len(err.Causes) == 0 {
+		return []*jsonschema.ValidationError{err}
+	}
+	var leaves []*jsonschema.ValidationError
+	for _, cause := range err.Causes {
+		leaves = append(leaves, leafErrors(cause)...)
+	}
+	return leaves
+}
+
+// lookupPointer returns where the value a JSON pointer such as
+// /proxmox/nodes/0 refers to is written: the key of a mapping entry or the
+// item of a list. If the value does not exist, it returns the deepest node
+// on the way to it that does.
+func lookupPointer(node *yaml.Node, pointer string) *yaml.Node {
+	if pointer == "" {
+		return node
+	}
+	at := node
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		var key, next *yaml.Node
+		switch node.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == token {
+					key, next = node.Content[i], node.Content[i+1]
+					break
+				}
+			}
+		case yaml.SequenceNode:
+			if i, err := strconv.Atoi(token); err == nil && i >= 0 && i < len(node.Content) {
+				key, next = node.Content[i], node.Content[i]
+			}
+		}
+		if next == nil {
+			return at
+		}
+		node, at = next, key
+	}
+	return at
+}
@@ -0,0 +1,302 @@
+// Package validate checks a configuration before anything runs: the beads of
+// the .kd files, the data file and the templates it lists. Every problem is
+// reported with the file and line it was found at.
+package validate
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/janpreet/kado/packages/bead"
+	"github.com/janpreet/kado/packages/config"
+	"github.com/janpreet/kado/packages/helper"
+	"github.com/janpreet/kado/packages/kd"
+	"github.com/janpreet/kado/packages/render"
+	"gopkg.in/yaml.v3"
+)
+
+// Problems collects diagnostics, ignoring repeats such as a template listed
+// for several beads.
+type Problems struct {
+	diags []kd.Diagnostic
+	seen  map[string]bool
+}
+
+func (p *Problems) add(pos kd.Pos, format string, a ...interface{}) {
+	d := kd.Diagnostic{Pos: pos, Message: fmt.Sprintf(format, a...)}
+	if p.seen == nil {
+		p.seen = make(map[string]bool)
+	}
+	if p.seen[d.String()] {
+		return
+	}
+	p.seen[d.String()] = true
+	p.diags = append(p.diags, d)
+}
+
+// Diagnostics returns the problems found, ordered by file and line.
+func (p *Problems) Diagnostics() []kd.Diagnostic {
+	diags := append([]kd.Diagnostic(nil), p.diags...)
+	sort.SliceStable(diags, func(i, j int) bool {
+		a, b := diags[i].Pos, diags[j].Pos
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return diags
+}
+
+// Beads checks that the beads named in depends_on and relay exist and that
+// the handler of every bead in runnable accepts its fields. runnable holds
+// the enabled beads as a run processes them, i.e. relay targets with the
+// relay_field overrides of their origins applied.
+func (p *Problems) Beads(beads []bead.Bead, runnable []bead.Bead) {
+	names := make(map[string]bool, len(beads))
+	for _, b := range beads {
+		names[b.Name] = true
+	}
+	for _, b := range beads {
+		if _, err := bead.Lookup(b.Type); err != nil {
+			p.add(b.Pos, "%v", err)
+		}
+		if source := b.Fields["source"]; source != "" {
+			p.source(b, source)
+		}
+		for _, field := range []string{"depends_on", "relay"} {
+			for _, name := range b.List(field) {
+				if !names[name] {
+					p.add(b.Position(field), "bead %s: unknown bead %q in %s", b.Name, name, field)
+				}
+			}
+		}
+	}
+
+	for _, b := range runnable {
+		handler, err := bead.Lookup(b.Type)
+		if err != nil {
+			continue
+		}
+		if err := bead.Validate(handler, b); err != nil {
+			p.handlerErrors(b, err)
+		}
+		if fields, ok := bead.Schema(handler); ok {
+			names := make([]string, 0, len(b.Fields))
+			for name := range b.Fields {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				if !hasField(fields, name) {
+					// Unknown fields of the bead itself are rejected when
+					// it is loaded, so this one was set by relay_field.
+					p.add(b.Position(name), "unknown field %q in %s bead %s, set by relay_field", name, b.Type, b.Name)
+				}
+			}
+		}
+		if source := b.Fields["source"]; source != "" {
+			p.source(b, source)
+		}
+		for _, path := range b.List("templates") {
+			p.template(path, b.Position("templates"))
+		}
+	}
+}
+
+// source checks that the source address of a bead parses and, if it is a
+// local directory or tarball, exists. In offline runs a remote source must
+// be vendored.
+func (p *Problems) source(b bead.Bead, address string) {
+	src, err := helper.ParseSource(address)
+	if err != nil {
+		p.add(b.Position("source"), "bead %s: %v", b.Name, err)
+		return
+	}
+	if _, err := helper.VendoredSource(address); err != nil {
+		p.add(b.Position("source"), "bead %s: %v", b.Name, err)
+		return
+	}
+	if src.Kind != helper.SourceGit && !strings.Contains(src.URL, "://") && !helper.FileExists(src.URL) {
+		p.add(b.Position("source"), "bead %s: source %s does not exist", b.Name, src.URL)
+	}
+}
+
+func hasField(fields []bead.Field, name string) bool {
+	for _, f := range fields {
+		if f.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// handlerErrors reports the errors returned by a handler's Validate, each
+// *bead.FieldError at the position of its field.
+func (p *Problems) handlerErrors(b bead.Bead, err error) {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, err := range joined.Unwrap() {
+			p.handlerErrors(b, err)
+		}
+		return
+	}
+	if fieldErr, ok := err.(*bead.FieldError); ok {
+		p.add(b.Position(fieldErr.Field), "%s", fieldErr.Msg)
+		return
+	}
+	p.add(b.Pos, "bead %s: %v", b.Name, err)
+}
+
+// yamlLineRegex matches the line yaml.v3 reports syntax errors at.
+var yamlLineRegex = regexp.MustCompile(`^yaml: line (\d+): `)
+
+// Data checks that the data file at path parses and that its kado section
+// has the expected shape: kado.templates is a list of template paths, or a
+// section of template paths per bead. Every template listed, or found in
+// --templates, must exist, start with a <file name> header and parse. The
+// rest of the data file must match the JSON Schema set as kado.schema.
+func (p *Problems) Data(path string, beads []bead.Bead) {
+	if config.TemplateDir != "" {
+		if paths, ok := render.TemplatePaths(nil); ok {
+			for _, templatePath := range paths {
+				p.template(templatePath, kd.Pos{File: templatePath, Line: 1, Column: 1})
+			}
+		}
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		p.add(kd.Pos{File: path}, "failed to read data file: %v", err)
+		return
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		pos := kd.Pos{File: path}
+		msg := err.Error()
+		if m := yamlLineRegex.FindStringSubmatch(msg); m != nil {
+			pos.Line, _ = strconv.Atoi(m[1])
+			pos.Column = 1
+			msg = msg[len(m[0]):]
+		}
+		p.add(pos, "failed to parse data file: %s", msg)
+		return
+	}
+	if len(doc.Content) == 0 {
+		return
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		p.add(nodePos(path, root), "the data file must be a mapping of keys to values, got %s", kindName(root))
+		return
+	}
+	kado := mappingValue(root, "kado")
+	if kado == nil {
+		return
+	}
+	if kado.Kind != yaml.MappingNode {
+		p.add(nodePos(path, kado), "kado must be a mapping, got %s", kindName(kado))
+		return
+	}
+	if schema := mappingValue(kado, "schema"); schema != nil && schema.Kind != yaml.ScalarNode {
+		p.add(nodePos(path, schema), "kado.schema must be the path of a JSON Schema, got %s", kindName(schema))
+	}
+	if strict := mappingValue(kado, "strict_templates"); strict != nil && (strict.Kind != yaml.ScalarNode || strict.ShortTag() != "!!bool") {
+		p.add(nodePos(path, strict), "kado.strict_templates must be true or false, got %s", kindName(strict))
+	}
+	p.schema(path, root)
+	p.templates(path, mappingValue(kado, "templates"), beads)
+}
+
+// templates checks kado.templates and the templates it lists.
+func (p *Problems) templates(path string, templates *yaml.Node, beads []bead.Bead) {
+	if templates == nil {
+		return
+	}
+
+	switch templates.Kind {
+	case yaml.SequenceNode:
+		if config.TemplateDir == "" {
+			p.templateList(path, templates)
+		}
+	case yaml.MappingNode:
+		names := make(map[string]bool, len(beads))
+		for _, b := range beads {
+			names[b.Name] = true
+		}
+		for i := 0; i+1 < len(templates.Content); i += 2 {
+			key, value := templates.Content[i], templates.Content[i+1]
+			if !names[key.Value] {
+				p.add(nodePos(path, key), "kado.templates: unknown bead %q", key.Value)
+			}
+			if value.Kind != yaml.SequenceNode {
+				p.add(nodePos(path, value), "kado.templates.%s must be a list of template paths, got %s", key.Value, kindName(value))
+				continue
+			}
+			p.templateList(path, value)
+		}
+	default:
+		p.add(nodePos(path, templates), "kado.templates must be a list of template paths or a list per bead, got %s", kindName(templates))
+	}
+}
+
+func (p *Problems) templateList(path string, list *yaml.Node) {
+	for _, item := range list.Content {
+		if item.Kind != yaml.ScalarNode {
+			p.add(nodePos(path, item), "template path must be a string, got %s", kindName(item))
+			continue
+		}
+		p.template(item.Value, nodePos(path, item))
+	}
+}
+
+// template checks one template, reporting a missing file at pos, where it
+// is listed, and problems with its content in the template itself.
+func (p *Problems) template(path string, pos kd.Pos) {
+	if _, err := os.Stat(path); err != nil {
+		p.add(pos, "template %s does not exist", path)
+		return
+	}
+	if err := render.CheckTemplate(path); err != nil {
+		if templateErr, ok := err.(*render.TemplateError); ok {
+			p.add(kd.Pos{File: templateErr.Path, Line: templateErr.Line, Column: 1}, "%s", templateErr.Msg)
+			return
+		}
+		p.add(pos, "%v", err)
+	}
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func nodePos(path string, node *yaml.Node) kd.Pos {
+	return kd.Pos{File: path, Line: node.Line, Column: node.Column}
+}
+
+func kindName(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "a mapping"
+	case yaml.SequenceNode:
+		return "a list"
+	case yaml.ScalarNode:
+		if node.Tag == "!!null" {
+			return "nothing"
+		}
+		return fmt.Sprintf("%q", node.Value)
+	case yaml.AliasNode:
+		return "an alias"
+	}
+	return "an empty document"
+}
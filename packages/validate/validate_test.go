@@ -0,0 +1,197 @@
+package validate
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/janpreet/kado/packages/bead"
+	"github.com/janpreet/kado/packages/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type requiresTarget struct{}
+
+func (requiresTarget) Validate(b bead.Bead) error {
+	var errs []error
+	if b.Fields["target"] == "" {
+		errs = append(errs, &bead.FieldError{Field: "target", Msg: "target is required"})
+	}
+	if b.Fields["mode"] == "bad" {
+		errs = append(errs, &bead.FieldError{Field: "mode", Msg: "unknown mode"})
+	}
+	return errors.Join(errs...)
+}
+func (requiresTarget) Plan(ctx *bead.Context, b bead.Bead) error  { return nil }
+func (requiresTarget) Apply(ctx *bead.Context, b bead.Bead) error { return nil }
+func (requiresTarget) Outputs(ctx *bead.Context, b bead.Bead) (map[string]interface{}, error) {
+	return nil, nil
+}
+
+func init() {
+	bead.Register("validate_test", requiresTarget{})
+}
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func messages(p *Problems) []string {
+	var result []string
+	for _, d := range p.Diagnostics() {
+		result = append(result, d.String())
+	}
+	return result
+}
+
+func TestBeads(t *testing.T) {
+	dir := t.TempDir()
+	kdFile := writeFile(t, dir, "test.kd", `bead "validate_test" "network" {
+  mode       = "bad"
+  depends_on = ["missing"]
+  templates  = ["`+filepath.Join(dir, "missing.tmpl")+`"]
+}
+`)
+	beads, err := config.LoadBeadsConfig(kdFile)
+	require.NoError(t, err)
+
+	var p Problems
+	p.Beads(beads, beads)
+	assert.Equal(t, []string{
+		kdFile + ":1:1: target is required",
+		kdFile + ":2:3: unknown mode",
+		kdFile + `:3:3: bead network: unknown bead "missing" in depends_on`,
+		kdFile + ":4:3: template " + filepath.Join(dir, "missing.tmpl") + " does not exist",
+	}, messages(&p))
+}
+
+func TestBeadSources(t *testing.T) {
+	dir := t.TempDir()
+	kdFile := writeFile(t, dir, "test.kd", `bead "validate_test" "network" {
+  target = "x"
+  source = "git::https://example.com/infra.git?depth=none"
+}
+
+bead "validate_test" "compute" {
+  target = "x"
+  source = "`+filepath.Join(dir, "missing")+`"
+}
+
+bead "validate_test" "storage" {
+  target = "x"
+  source = "git::https://example.com/infra.git//storage?ref=v1.2&depth=1"
+}
+`)
+	beads, err := config.LoadBeadsConfig(kdFile)
+	require.NoError(t, err)
+
+	var p Problems
+	p.Beads(beads, beads)
+	assert.Equal(t, []string{
+		kdFile + `:3:3: bead network: depth must be a positive number in source git::https://example.com/infra.git?depth=none, got "none"`,
+		kdFile + ":8:3: bead compute: source " + filepath.Join(dir, "missing") + " does not exist",
+	}, messages(&p))
+}
+
+func TestData(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "empty.tmpl", "")
+	writeFile(t, dir, "broken.tmpl", "<out.txt>\nok\n{{ .Get \"a\" }\n")
+	writeFile(t, dir, "good.tmpl", "<good.txt>\n{{ .Get \"a\" }}\n")
+	data := writeFile(t, dir, "cluster.yaml", `kado:
+  templates:
+    network:
+      - `+filepath.Join(dir, "good.tmpl")+`
+      - `+filepath.Join(dir, "empty.tmpl")+`
+    compute:
+      - `+filepath.Join(dir, "broken.tmpl")+`
+    other: x
+`)
+
+	var p Problems
+	p.Data(data, []bead.Bead{{Name: "network"}, {Name: "compute"}})
+	assert.Equal(t, []string{
+		filepath.Join(dir, "broken.tmpl") + `:3:1: unexpected "}" in operand`,
+		data + `:8:5: kado.templates: unknown bead "other"`,
+		data + `:8:12: kado.templates.other must be a list of template paths, got "x"`,
+		filepath.Join(dir, "empty.tmpl") + ":1:1: missing file name header, expected <file name> on the first line",
+	}, messages(&p))
+}
+
+func TestDataShape(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"kado:\n", ":1:6: kado must be a mapping, got nothing"},
+		{"kado:\n  templates: templates/a.tmpl\n", `:2:14: kado.templates must be a list of template paths or a list per bead, got "templates/a.tmpl"`},
+		{"kado:\n  strict_templates: yes please\n", `:2:21: kado.strict_templates must be true or false, got "yes please"`},
+		{"- a\n- b\n", ":1:1: the data file must be a mapping of keys to values, got a list"},
+		{"kado: [\n", ":1:1: failed to parse data file: did not find expected node content"},
+	}
+	for _, tt := range tests {
+		data := writeFile(t, dir, "cluster.yaml", tt.content)
+		var p Problems
+		p.Data(data, nil)
+		assert.Equal(t, []string{data + tt.want}, messages(&p), tt.content)
+	}
+
+	var p Problems
+	p.Data(filepath.Join(dir, "missing.yaml"), nil)
+	require.Len(t, p.Diagnostics(), 1)
+	assert.Contains(t, p.Diagnostics()[0].String(), "failed to read data file")
+}
+
+func TestDataSchema(t *testing.T) {
+	dir := t.TempDir()
+	schemaPath := writeFile(t, dir, "schema.json", `{
+  "type": "object",
+  "required": ["proxmox"],
+  "properties": {
+    "proxmox": {
+      "type": "object",
+      "required": ["api_url"],
+      "properties": {"port": {"type": "integer"}, "nodes": {"type": "array"}}
+    }
+  },
+  "additionalProperties": false
+}`)
+	data := writeFile(t, dir, "cluster.yaml", `kado:
+  schema: `+schemaPath+`
+proxmox:
+  port: "8006"
+  nodes:
+    - a
+    - b
+extra: 1
+`)
+
+	var p Problems
+	p.Data(data, nil)
+	assert.Equal(t, []string{
+		data + ":1:1: /: additionalProperties 'extra' not allowed",
+		data + ":3:1: /proxmox: missing properties: 'api_url'",
+		data + ":4:3: /proxmox/port: expected integer, but got string",
+	}, messages(&p))
+
+	schema, err := DataSchema(data)
+	require.NoError(t, err)
+	assert.Equal(t, KadoSchema, schema["properties"].(map[string]interface{})["kado"])
+	assert.Contains(t, schema["properties"], "proxmox")
+
+	data = writeFile(t, dir, "cluster.yaml", "kado:\n  schema: missing.json\n")
+	p = Problems{}
+	p.Data(data, nil)
+	require.Len(t, p.Diagnostics(), 1)
+	assert.Contains(t, p.Diagnostics()[0].String(), data+":2:11: failed to load schema missing.json")
+
+	schema, err = DataSchema(writeFile(t, dir, "plain.yaml", "proxmox: {}\n"))
+	require.NoError(t, err)
+	assert.Nil(t, schema)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/janpreet/kado/packages/bead"
+	"github.com/janpreet/kado/packages/config"
+	"github.com/janpreet/kado/packages/display"
+	"github.com/janpreet/kado/packages/helper"
+	"github.com/janpreet/kado/packages/lockfile"
+	"github.com/janpreet/kado/packages/opa"
+	"github.com/janpreet/kado/packages/report"
+)
+
+// policyTarget is an OPA bead as a run evaluates it: on its own, or relayed
+// from origin with the origin's relay_field overrides applied.
+type policyTarget struct {
+	bead   bead.Bead
+	origin *bead.Bead
+}
+
+// policyTargets lists the OPA beads of the enabled beads in declaration
+// order. An OPA bead that other beads relay to is tested once per origin
+// instead of on its own, since its paths are then relative to the origin.
+func policyTargets(beads []bead.Bead, beadMap map[string]bead.Bead) []policyTarget {
+	var targets []policyTarget
+	relayed := make(map[string]bool)
+	for _, b := range beads {
+		for _, name := range b.List("relay") {
+			relay, ok := beadMap[name]
+			if !ok || relay.Type != "opa" || (relay.Enabled != nil && !*relay.Enabled) {
+				continue
+			}
+			origin := b
+			targets = append(targets, policyTarget{bead: relayedBead(b, relay), origin: &origin})
+			relayed[relay.Name] = true
+		}
+	}
+	for _, b := range beads {
+		if b.Type == "opa" && !relayed[b.Name] {
+			targets = append(targets, policyTarget{bead: b})
+		}
+	}
+	return targets
+}
+
+// runPolicyTests clones the repositories the OPA beads read their policies
+// from and runs the rego unit tests of every OPA bead, or of the named
+// beads, which may be OPA beads or the beads relaying to them.
+func runPolicyTests(names []string, reportFormat string, clean bool) error {
+	switch reportFormat {
+	case "", report.FormatJSON, report.FormatJUnit:
+	default:
+		return fmt.Errorf("unknown report format %q, expected %s or %s", reportFormat, report.FormatJSON, report.FormatJUnit)
+	}
+
+	allBeads, beadMap, err := loadBeads()
+	if err != nil {
+		return err
+	}
+	selected := make(map[string]bool, len(names))
+	for _, name := range names {
+		if _, ok := beadMap[name]; !ok {
+			return fmt.Errorf("unknown bead %q", name)
+		}
+		selected[name] = true
+	}
+	validBeads, _ := config.GetValidBeadsWithDefaultEnabled(allBeads)
+
+	lock, err := helper.SetupLandingZone(clean)
+	if err != nil {
+		return fmt.Errorf("failed to setup LandingZone: %v", err)
+	}
+	defer lock.Release()
+
+	sources, err := lockfile.Read(lockfile.FileName)
+	if err != nil {
+		return err
+	}
+
+	rep := report.New("test")
+	cloned := make(map[string]bool)
+	var failed []string
+	for _, t := range policyTargets(validBeads, beadMap) {
+		if len(selected) > 0 && !selected[t.bead.Name] && (t.origin == nil || !selected[t.origin.Name]) {
+			continue
+		}
+		if err := testPolicyBead(rep, t, cloned, sources); err != nil {
+			slog.Error("Policy tests failed", "bead", t.bead.Name, "error", err)
+			failed = append(failed, fmt.Sprintf("%s: %v", t.bead.Name, err))
+		}
+	}
+
+	if reportErr := writeReport(rep, reportFormat); reportErr != nil {
+		slog.Error("Failed to write run report", "error", reportErr)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("policy tests failed:\n%s", strings.Join(failed, "\n"))
+	}
+	return nil
+}
+
+// testPolicyBead runs the policy tests of one target. cloned records the
+// beads whose repositories are already in the LandingZone; sources are
+// checked out at the commits kado.lock pins them to.
+func testPolicyBead(rep *report.Report, t policyTarget, cloned map[string]bool, sources *lockfile.File) (err error) {
+	b := t.bead
+	var relayChain []string
+	var origin bead.Bead
+	if t.origin != nil {
+		origin = *t.origin
+		relayChain = []string{origin.Name}
+	}
+
+	stdout := display.NewPrefixWriter(os.Stdout, "["+b.Name+"] ")
+	stderr := display.NewPrefixWriter(os.Stderr, "["+b.Name+"] ")
+	defer stdout.Flush()
+	defer stderr.Flush()
+
+	ctx := &bead.Context{
+		Context:     context.Background(),
+		LandingZone: config.LandingZone,
+		Origin:      origin.Name,
+		OriginType:  origin.Type,
+		Stdout:      stdout,
+		Stderr:      stderr,
+		Logger:      slog.Default().With("bead", b.Name, "type", b.Type),
+		Result:      rep.Start(b.Name, b.Type, relayChain),
+	}
+	defer func() {
+		rep.Finish(ctx.Result, err)
+	}()
+	ctx.Log().Info("Testing policies", "origin", origin.Name, "path", b.Fields["path"])
+
+	ctx.SetPhase("clone")
+	for _, src := range []bead.Bead{origin, b} {
+		if src.Fields["source"] == "" || cloned[src.Name] {
+			continue
+		}
+		cloned[src.Name] = true
+		if _, err := helper.CloneRepo(ctx, src.Fields["source"], config.LandingZone, src.Name, pinnedRefs(sources, src.Fields["source"], src.Fields["refs"])); err != nil {
+			return fmt.Errorf("failed to clone repo for bead %s: %v", src.Name, err)
+		}
+	}
+
+	ctx.SetPhase("test")
+	summary, err := opa.RunTests(ctx, b)
+	ctx.Result.SetTests(summary)
+	if err != nil {
+		return err
+	}
+	ctx.Log().Info("Policy tests passed", "passed", summary.Passed, "skipped", summary.Skipped, "coverage", summary.Coverage)
+	return nil
+}
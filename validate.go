@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/janpreet/kado/packages/bead"
+	"github.com/janpreet/kado/packages/config"
+	"github.com/janpreet/kado/packages/kd"
+	"github.com/janpreet/kado/packages/validate"
+)
+
+// runnableBeads returns the enabled beads the way a run processes them: a
+// bead that enabled beads relay to is returned once per origin, with the
+// relay_field overrides of that origin applied, instead of on its own.
+func runnableBeads(beads []bead.Bead, beadMap map[string]bead.Bead) []bead.Bead {
+	validBeads, _ := config.GetValidBeadsWithDefaultEnabled(beads)
+	relayed := make(map[string]bool)
+	for _, b := range validBeads {
+		for _, name := range b.List("relay") {
+			relayed[name] = true
+		}
+	}
+
+	var runnable []bead.Bead
+	var walk func(b bead.Bead, chain map[string]bool)
+	walk = func(b bead.Bead, chain map[string]bool) {
+		runnable = append(runnable, b)
+		chain[b.Name] = true
+		defer delete(chain, b.Name)
+		for _, name := range b.List("relay") {
+			target, ok := beadMap[name]
+			if !ok || chain[name] || (target.Enabled != nil && !*target.Enabled) {
+				continue
+			}
+			walk(relayedBead(b, target), chain)
+		}
+	}
+	for _, b := range validBeads {
+		if !relayed[b.Name] {
+			walk(b, make(map[string]bool))
+		}
+	}
+	return runnable
+}
+
+// validateConfig checks the beads, the data file and the templates before
+// anything runs. It returns every problem found, ordered by file and line.
+func validateConfig(beads []bead.Bead, beadMap map[string]bead.Bead, yamlFilePath string) []kd.Diagnostic {
+	var problems validate.Problems
+	problems.Beads(beads, runnableBeads(beads, beadMap))
+	problems.Data(yamlFilePath, beads)
+	return problems.Diagnostics()
+}
+
+// checkConfig prints the problems validateConfig finds and fails if there
+// are any.
+func checkConfig(beads []bead.Bead, beadMap map[string]bead.Bead, yamlFilePath string) error {
+	diags := validateConfig(beads, beadMap, yamlFilePath)
+	for _, d := range diags {
+		fmt.Println(d)
+	}
+	if len(diags) > 0 {
+		return fmt.Errorf("found %d problem(s) in the configuration", len(diags))
+	}
+	return nil
+}
+
+// beadSchema returns a JSON Schema document with the fields of the named bead
+// types, or of every registered type, under $defs.
+func beadSchema(types []string) (map[string]interface{}, error) {
+	if len(types) == 0 {
+		types = bead.Registered()
+	}
+	defs := make(map[string]interface{}, len(types))
+	for _, name := range types {
+		handler, err := bead.Lookup(name)
+		if err != nil {
+			return nil, err
+		}
+		fields, ok := bead.Schema(handler)
+		if !ok {
+			fields = bead.CommonFields
+		}
+		schema := bead.JSONSchema(fields)
+		if !ok {
+			// Beads of this type accept any field.
+			schema["additionalProperties"] = true
+		}
+		defs[name] = schema
+	}
+	return map[string]interface{}{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"title":   "kado bead fields",
+		"$defs":   defs,
+	}, nil
+}
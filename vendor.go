@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/janpreet/kado/packages/bead"
+	"github.com/janpreet/kado/packages/config"
+	"github.com/janpreet/kado/packages/helper"
+	"github.com/janpreet/kado/packages/lockfile"
+)
+
+// vendorSources stores the source of every bead a run processes, including
+// sources set by relay_field, in config.VendorDir so that runs with
+// --offline need no network. Commits pinned in kado.lock must be in the
+// vendored repositories. With archive set the vendor directory is also
+// packed into that tarball, to copy to hosts without network access.
+func vendorSources(yamlFilePath, archive string) error {
+	if config.Offline {
+		return fmt.Errorf("kado vendor fetches sources from the network and cannot run with --offline")
+	}
+	allBeads, beadMap, err := loadBeads()
+	if err != nil {
+		return err
+	}
+	if err := checkConfig(allBeads, beadMap, yamlFilePath); err != nil {
+		return err
+	}
+	sources, err := lockfile.Read(lockfile.FileName)
+	if err != nil {
+		return err
+	}
+
+	vendored := make(map[string]string)
+	for _, b := range runnableBeads(allBeads, beadMap) {
+		source, refs := b.Fields["source"], b.Fields["refs"]
+		if source == "" {
+			continue
+		}
+		ctx := &bead.Context{
+			Context: context.Background(),
+			Logger:  slog.Default().With("bead", b.Name, "type", b.Type),
+		}
+		path, ok := vendored[source]
+		if !ok {
+			path, err = helper.VendorSource(ctx, source)
+			if err != nil {
+				return fmt.Errorf("failed to vendor source of bead %s: %v", b.Name, err)
+			}
+			vendored[source] = path
+		}
+		if entry, ok := sources.Lookup(source, refs); ok && path != "" && !helper.HasCommit(ctx, path, entry.Commit) {
+			return fmt.Errorf("commit %s of bead %s, pinned in %s, is not in %s; run `kado lock --update` to pin one that is", entry.Commit, b.Name, lockfile.FileName, source)
+		}
+	}
+	slog.Info("Sources vendored", "dir", config.VendorDir, "sources", len(vendored))
+
+	if archive != "" {
+		if err := os.MkdirAll(config.VendorDir, 0755); err != nil {
+			return fmt.Errorf("failed to create vendor directory: %v", err)
+		}
+		if err := helper.WriteArchive(config.VendorDir, archive); err != nil {
+			return err
+		}
+		slog.Info("Vendor archive written", "file", archive)
+	}
+	return nil
+}